@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"simple-listener/internal/store"
+)
+
+// adminServer 本地管理 HTTP API，所有接口都需要 token
+type adminServer struct {
+	l     *listener
+	token string
+	mux   *http.ServeMux
+}
+
+func newAdminServer(l *listener, token string) *adminServer {
+	s := &adminServer{l: l, token: token, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/api/config", s.handleConfig)
+	s.mux.HandleFunc("/api/channels", s.handleChannels)
+	s.mux.HandleFunc("/api/matches", s.handleMatches)
+	s.mux.HandleFunc("/api/queues", s.handleQueues)
+	s.mux.HandleFunc("/api/links", s.handleLinks)
+	s.mux.HandleFunc("/api/backfill", s.handleBackfill)
+	s.mux.HandleFunc("/api/keywords", s.handleKeywords)
+	s.mux.HandleFunc("/api/test", s.handleTest)
+	s.mux.HandleFunc("/api/traces", s.handleTraces)
+	return s
+}
+
+// ServeHTTP 校验 token 后分发请求，支持 Authorization: Bearer <token> 和 X-Admin-Token
+func (s *adminServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := r.Header.Get("X-Admin-Token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		writeError(w, http.StatusUnauthorized, "token 无效")
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// runHTTPServer 启动 HTTP 服务，ctx 结束时关闭，name 用于日志
+func runHTTPServer(ctx context.Context, name, addr string, handler http.Handler) {
+	// 先监听端口，端口被占用等错误不会被记录为已启动
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		logHTTP.Error(name+"启动失败", "addr", addr, "error", err)
+		return
+	}
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	logHTTP.Info(name+"已启动", "addr", ln.Addr().String())
+	if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logHTTP.Error(name+"运行失败", "addr", addr, "error", err)
+	}
+}
+
+// writeJSON 输出 JSON 响应
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+// writeError 输出错误响应
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// allowMethods 检查请求方法，不允许时输出 405
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "不支持的请求方法")
+	return false
+}
+
+// GET /api/config 当前配置，密钥和代理密码已隐藏
+func (s *adminServer) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	c := s.l.currentConfig()
+
+	const hidden = "******"
+	if c.API.ApiHash != "" {
+		c.API.ApiHash = hidden
+	}
+	if c.SubscriptionAPI.ApiKey != "" {
+		c.SubscriptionAPI.ApiKey = hidden
+	}
+	c.Admin.Token = hidden
+	redact := func(raw string) string {
+		if p, err := parseProxy(raw); err == nil {
+			return p.String()
+		}
+		return hidden
+	}
+	if c.API.Proxy != "" {
+		c.API.Proxy = redact(c.API.Proxy)
+	}
+	proxies := make([]string, len(c.API.Proxies))
+	for i, raw := range c.API.Proxies {
+		proxies[i] = redact(raw)
+	}
+	c.API.Proxies = proxies
+
+	writeJSON(w, http.StatusOK, c)
+}
+
+// GET /api/channels 监听频道及最近一条消息的时间
+func (s *adminServer) handleChannels(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	type channelInfo struct {
+		ID          int64      `json:"id"`
+		Title       string     `json:"title,omitempty"`
+		Accessible  *bool      `json:"accessible,omitempty"`
+		LastMessage *time.Time `json:"last_message,omitempty"`
+	}
+
+	ids := s.l.monitorChannels()
+	channels := make([]channelInfo, 0, len(ids))
+	for _, id := range ids {
+		info := channelInfo{ID: id}
+		if s.l.links != nil {
+			if status, ok := s.l.links.ChannelStatus(id); ok {
+				info.Title = status.Title
+				info.Accessible = &status.Accessible
+			}
+		}
+		if t := registry.LastSeen(id); !t.IsZero() {
+			info.LastMessage = &t
+		}
+		channels = append(channels, info)
+	}
+	writeJSON(w, http.StatusOK, channels)
+}
+
+// GET /api/matches?limit=20 最近提取到链接的消息
+func (s *adminServer) handleMatches(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	if s.l.links == nil {
+		writeJSON(w, http.StatusOK, []*store.MessageRecord{})
+		return
+	}
+
+	limit := 20
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "limit 必须是正整数")
+			return
+		}
+		limit = n
+	}
+	writeJSON(w, http.StatusOK, s.l.links.Recent(limit))
+}
+
+// GET /api/queues 各队列中等待处理的数量
+func (s *adminServer) handleQueues(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	l := s.l
+	queues := map[string]any{"paused": l.paused.Load()}
+	if l.albums != nil {
+		queues["albums"] = l.albums.Pending()
+	}
+	if l.forwards != nil {
+		queues["forward"] = l.forwards.Pending()
+	}
+	if l.notices != nil {
+		queues["notify"] = l.notices.Pending()
+	}
+	writeJSON(w, http.StatusOK, queues)
+}
+
+// GET /api/links?url=... 查询链接是否已处理过
+func (s *adminServer) handleLinks(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	url := r.URL.Query().Get("url")
+	if url == "" {
+		writeError(w, http.StatusBadRequest, "缺少 url 参数")
+		return
+	}
+	records := []*store.MessageRecord{}
+	if s.l.links != nil {
+		records = append(records, s.l.links.FindLink(url)...)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"url":     url,
+		"seen":    len(records) > 0,
+		"records": records,
+	})
+}
+
+// POST /api/backfill {"channel": "@username 或频道 ID", "limit": 100} 重新获取频道历史消息
+func (s *adminServer) handleBackfill(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+
+	// channel 可以是字符串或数字
+	var req struct {
+		Channel any `json:"channel"`
+		Limit   int `json:"limit"`
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&req); err != nil || req.Channel == nil {
+		writeError(w, http.StatusBadRequest, "请求格式: {\"channel\": \"@username 或频道 ID\", \"limit\": 100}")
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 100
+	}
+
+	api := tgAPI.Load()
+	if api == nil {
+		writeError(w, http.StatusServiceUnavailable, "客户端未就绪")
+		return
+	}
+	channelID, err := resolveChannelArg(r.Context(), fmt.Sprint(req.Channel))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	matched, err := s.l.fetchChannelHistory(r.Context(), api, selfID.Load(), channelID, req.Limit)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"channel": channelID,
+		"limit":   req.Limit,
+		"matched": matched,
+	})
+}
+
+// GET /api/keywords 关键词列表
+// POST /api/keywords {"keyword": "foo"} 添加关键词
+// DELETE /api/keywords?keyword=foo 移除关键词
+func (s *adminServer) handleKeywords(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPost, http.MethodDelete) {
+		return
+	}
+
+	var (
+		keywords []string
+		err      error
+	)
+	switch r.Method {
+	case http.MethodGet:
+		keywords = s.l.pipeline.Config().Keywords
+	case http.MethodPost:
+		var req struct {
+			Keyword string `json:"keyword"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "请求格式: {\"keyword\": \"...\"}")
+			return
+		}
+		keywords, err = s.l.updateKeywords(true, req.Keyword)
+	case http.MethodDelete:
+		keywords, err = s.l.updateKeywords(false, r.URL.Query().Get("keyword"))
+	}
+	if err != nil && keywords == nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp := map[string]any{"keywords": keywords}
+	if err != nil {
+		// 已生效但写回配置文件失败
+		resp["warning"] = err.Error()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// POST /api/test {"text": "..."} 按当前配置测试过滤结果，不提交订阅
+func (s *adminServer) handleTest(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+
+	var req struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Text == "" {
+		writeError(w, http.StatusBadRequest, "请求格式: {\"text\": \"...\"}")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.l.testFilter(req.Text))
+}
+
+// GET /api/traces?limit=50&channel=123&outcome=no_keyword 最近消息的过滤过程
+func (s *adminServer) handleTraces(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	query := r.URL.Query()
+	limit := 50
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "limit 必须是正整数")
+			return
+		}
+		limit = n
+	}
+	var channelID int64
+	if v := query.Get("channel"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "channel 必须是频道 ID")
+			return
+		}
+		channelID = id
+	}
+	writeJSON(w, http.StatusOK, traces.Recent(limit, channelID, query.Get("outcome")))
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// albumBuffer 按 GroupedID 暂存相册中的消息
+// 相册的各条消息会分别到达，等待一小段时间后合并为一组再执行过滤
+// 合并在更新处理器返回之后进行，使用 Run 传入的 ctx 而不是更新处理器的 ctx
+type albumBuffer struct {
+	mu     sync.Mutex
+	ctx    context.Context
+	window time.Duration
+	groups map[string]*pendingAlbum
+}
+
+// pendingAlbum 等待合并的相册
+type pendingAlbum struct {
+	messages []*tg.Message
+	timer    *time.Timer
+}
+
+func newAlbumBuffer(window time.Duration) *albumBuffer {
+	return &albumBuffer{
+		ctx:    context.Background(),
+		window: window,
+		groups: make(map[string]*pendingAlbum),
+	}
+}
+
+// albumKey 相册的唯一标识，GroupedID 只保证在同一个对话内唯一
+func albumKey(msg *tg.Message) string {
+	var peerID int64
+	switch peer := msg.PeerID.(type) {
+	case *tg.PeerChannel:
+		peerID = peer.ChannelID
+	case *tg.PeerChat:
+		peerID = peer.ChatID
+	case *tg.PeerUser:
+		peerID = peer.UserID
+	}
+	return fmt.Sprintf("%d:%d", peerID, msg.GroupedID)
+}
+
+// Run 设置合并相册时使用的 ctx，ctx 结束后丢弃等待中的相册
+func (b *albumBuffer) Run(ctx context.Context) {
+	b.mu.Lock()
+	b.ctx = ctx
+	b.mu.Unlock()
+
+	<-ctx.Done()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for key, album := range b.groups {
+		album.timer.Stop()
+		delete(b.groups, key)
+	}
+}
+
+// Add 加入一条相册消息，最后一条消息到达 window 时间后调用 flush 处理整个相册
+func (b *albumBuffer) Add(msg *tg.Message, flush func(ctx context.Context, messages []*tg.Message)) {
+	key := albumKey(msg)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	album, ok := b.groups[key]
+	if !ok {
+		album = &pendingAlbum{}
+		b.groups[key] = album
+		album.timer = time.AfterFunc(b.window, func() {
+			b.mu.Lock()
+			if b.groups[key] != album {
+				// Run 结束时已丢弃
+				b.mu.Unlock()
+				return
+			}
+			delete(b.groups, key)
+			messages := album.messages
+			ctx := b.ctx
+			b.mu.Unlock()
+
+			sort.Slice(messages, func(i, j int) bool {
+				return messages[i].ID < messages[j].ID
+			})
+			flush(ctx, messages)
+		})
+	} else {
+		// 每收到一条新消息就重新计时
+		album.timer.Reset(b.window)
+	}
+	album.messages = append(album.messages, msg)
+}
+
+// Replace 用编辑后的消息替换等待合并的相册中的同一条消息，消息不在等待中的相册里时返回 false
+func (b *albumBuffer) Replace(msg *tg.Message) bool {
+	key := albumKey(msg)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	album, ok := b.groups[key]
+	if !ok {
+		return false
+	}
+	for i, m := range album.messages {
+		if m.ID == msg.ID {
+			album.messages[i] = msg
+			return true
+		}
+	}
+	return false
+}
+
+// Pending 返回等待合并的相册数
+func (b *albumBuffer) Pending() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.groups)
+}
+
+// groupAlbums 将按时间顺序排列的消息按 GroupedID 分组，不属于相册的消息单独成组
+func groupAlbums(messages []*tg.Message) [][]*tg.Message {
+	var groups [][]*tg.Message
+	for _, msg := range messages {
+		last := len(groups) - 1
+		if msg.GroupedID != 0 && last >= 0 && groups[last][0].GroupedID == msg.GroupedID {
+			groups[last] = append(groups[last], msg)
+			continue
+		}
+		groups = append(groups, []*tg.Message{msg})
+	}
+	return groups
+}
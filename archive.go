@@ -0,0 +1,77 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/tg"
+
+	"simple-listener/internal/extractor"
+	"simple-listener/internal/filter"
+	"simple-listener/internal/store"
+)
+
+// archiveMessages 归档一条消息或一个相册的处理结果
+// records 为提交的链接结果，其余在消息中出现的链接按是否通过过滤标记为黑名单或未提交
+func (l *listener) archiveMessages(src messageSource, messages []*tg.Message, text string, verdict filter.Verdict, records []*store.LinkRecord) {
+	if l.archive == nil || verdict.Outcome == filter.Skipped {
+		return
+	}
+
+	e := &store.ArchiveEntry{
+		ChannelID: src.ChannelID,
+		PeerID:    src.PeerID,
+		Date:      time.Unix(int64(messages[0].Date), 0),
+		Source:    src.Label(),
+		Text:      text,
+		Rule:      verdict.Rule,
+		Outcome:   verdict.Outcome,
+	}
+	for _, m := range messages {
+		e.MessageIDs = append(e.MessageIDs, m.ID)
+		if m.EditDate > e.EditDate {
+			e.EditDate = m.EditDate
+		}
+	}
+	if outcome := linksOutcome(records); outcome != "" {
+		e.Outcome = outcome
+	}
+
+	submitted := make(map[string]*store.LinkRecord, len(records))
+	for _, r := range records {
+		submitted[r.URL] = r
+	}
+	for _, link := range extractor.Unique(extractor.FindLinks(text)) {
+		switch r, ok := submitted[link]; {
+		case ok:
+			e.Links = append(e.Links, r)
+			delete(submitted, link)
+		case verdict.Matched():
+			e.Links = append(e.Links, &store.LinkRecord{URL: link, Status: store.Blacklisted})
+		default:
+			e.Links = append(e.Links, &store.LinkRecord{URL: link, Status: store.Ignored})
+		}
+	}
+	// 编辑前提交过、现在已不在消息中的链接
+	for _, r := range records {
+		if _, ok := submitted[r.URL]; ok {
+			e.Links = append(e.Links, r)
+		}
+	}
+
+	if err := l.archive.Save(e); err != nil {
+		logStore.Error("归档消息失败", "error", err)
+	}
+}
+
+// linksOutcome 汇总链接的处理结果，如 "submitted" 或 "submitted,duplicate"
+func linksOutcome(records []*store.LinkRecord) string {
+	var statuses []string
+	for _, r := range records {
+		if !slices.Contains(statuses, r.Status) {
+			statuses = append(statuses, r.Status)
+		}
+	}
+	return strings.Join(statuses, ",")
+}
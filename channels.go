@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gotd/td/telegram/updates"
+	"github.com/gotd/td/tg"
+
+	"simple-listener/internal/config"
+)
+
+// 论坛中没有话题信息的消息属于 General 话题，其 ID 固定为 1
+const generalTopicID = 1
+
+// 保存的频道 access hash，由 main 在创建 gaps 时设置
+var accessHasher updates.ChannelAccessHasher
+
+// 当前登录的 Telegram API 客户端和用户 ID，由 runClient 在登录后设置
+var (
+	tgAPI  atomic.Pointer[tg.Client]
+	selfID atomic.Int64
+)
+
+// channelRegistry 登录后解析出的频道信息
+type channelRegistry struct {
+	mu          sync.RWMutex
+	discussions map[int64]int64        // 讨论组 ID -> 所属频道 ID
+	topics      map[int64]map[int]bool // 频道 ID -> 允许的话题 ID
+	lastSeen    map[int64]time.Time    // 频道 ID -> 最近一条消息的时间
+}
+
+var registry = &channelRegistry{
+	discussions: make(map[int64]int64),
+	topics:      make(map[int64]map[int]bool),
+	lastSeen:    make(map[int64]time.Time),
+}
+
+// touch 记录频道最近一条消息的时间
+func (r *channelRegistry) touch(channelID int64, date int) {
+	t := time.Unix(int64(date), 0)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t.After(r.lastSeen[channelID]) {
+		r.lastSeen[channelID] = t
+	}
+}
+
+// LastSeen 返回频道最近一条消息的时间，没有收到过消息时返回零值
+func (r *channelRegistry) LastSeen(channelID int64) time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.lastSeen[channelID]
+}
+
+// discussionParent 返回讨论组所属的频道 ID
+func (r *channelRegistry) discussionParent(chatID int64) (int64, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	parent, ok := r.discussions[chatID]
+	return parent, ok
+}
+
+// topicAllowed 检查消息所在话题是否在频道的话题过滤列表中，未配置话题过滤时全部允许
+func (r *channelRegistry) topicAllowed(chatID int64, topicID int) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	allowed, ok := r.topics[chatID]
+	if !ok {
+		return true
+	}
+	if topicID == 0 {
+		topicID = generalTopicID
+	}
+	return allowed[topicID]
+}
+
+// resolveChannelOptions 登录后解析频道的讨论组和话题配置
+// 解析前先按配置中的数字话题 ID 设置话题过滤，频道或话题解析失败时只允许这些话题，而不是全部允许
+func resolveChannelOptions(ctx context.Context, api *tg.Client, userID int64, options map[int64]config.ChannelOptions) {
+	seedTopics(options)
+	for channelID, opts := range options {
+		if !opts.IncludeDiscussion && len(opts.Topics) == 0 {
+			continue
+		}
+
+		channel, err := resolveChannel(ctx, api, userID, channelID)
+		if err != nil {
+			logChannels.Warn("解析频道配置失败", "channel", channelID, "error", err)
+			continue
+		}
+
+		if opts.IncludeDiscussion {
+			if err := resolveDiscussion(ctx, api, channel); err != nil {
+				logChannels.Warn("获取频道的讨论组失败", "channel", channelID, "error", err)
+			}
+		}
+
+		if len(opts.Topics) > 0 {
+			if err := resolveTopics(ctx, api, channel, opts.Topics); err != nil {
+				logChannels.Warn("获取频道的话题失败", "channel", channelID, "error", err)
+			}
+		}
+	}
+}
+
+// resolveDiscussion 获取频道关联的讨论组
+func resolveDiscussion(ctx context.Context, api *tg.Client, channel *tg.Channel) error {
+	full, err := api.ChannelsGetFullChannel(ctx, channel.AsInput())
+	if err != nil {
+		return err
+	}
+	channelFull, ok := full.FullChat.(*tg.ChannelFull)
+	if !ok || channelFull.LinkedChatID == 0 {
+		logChannels.Info("频道没有关联讨论组", "channel", channel.ID, "title", channel.Title)
+		return nil
+	}
+
+	registry.mu.Lock()
+	registry.discussions[channelFull.LinkedChatID] = channel.ID
+	registry.mu.Unlock()
+
+	logChannels.Info("找到频道的讨论组", "channel", channel.ID, "title", channel.Title, "discussion", channelFull.LinkedChatID)
+	return nil
+}
+
+// parseTopics 将配置中的话题分为数字话题 ID 和需要查询的话题标题
+func parseTopics(topics []string) (map[int]bool, []string) {
+	allowed := make(map[int]bool)
+	var titles []string
+	for _, topic := range topics {
+		topic = strings.TrimSpace(topic)
+		if id, err := strconv.Atoi(topic); err == nil {
+			allowed[id] = true
+		} else if topic != "" {
+			titles = append(titles, topic)
+		}
+	}
+	return allowed, titles
+}
+
+// seedTopics 按配置中的数字话题 ID 设置尚未解析的频道的话题过滤
+// 只配置了话题标题的频道在解析完成前不允许任何话题
+func seedTopics(options map[int64]config.ChannelOptions) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	for channelID, opts := range options {
+		if len(opts.Topics) == 0 {
+			continue
+		}
+		if _, ok := registry.topics[channelID]; !ok {
+			registry.topics[channelID], _ = parseTopics(opts.Topics)
+		}
+	}
+}
+
+// resolveTopics 将配置中的话题 ID 或标题解析为话题 ID
+// 查询话题列表失败时保留已有的话题过滤
+func resolveTopics(ctx context.Context, api *tg.Client, channel *tg.Channel, topics []string) error {
+	allowed, titles := parseTopics(topics)
+
+	// 按标题配置的话题需要查询话题列表
+	if len(titles) > 0 {
+		result, err := api.ChannelsGetForumTopics(ctx, &tg.ChannelsGetForumTopicsRequest{
+			Channel: channel.AsInput(),
+			Limit:   100,
+		})
+		if err != nil {
+			return err
+		}
+		for _, title := range titles {
+			found := false
+			for _, t := range result.Topics {
+				if topic, ok := t.(*tg.ForumTopic); ok && strings.EqualFold(topic.Title, title) {
+					allowed[topic.ID] = true
+					found = true
+				}
+			}
+			if !found {
+				logChannels.Warn("频道中未找到话题", "channel", channel.ID, "title", channel.Title, "topic", title)
+			}
+		}
+	}
+
+	registry.mu.Lock()
+	registry.topics[channel.ID] = allowed
+	registry.mu.Unlock()
+
+	ids := make([]int, 0, len(allowed))
+	for id := range allowed {
+		ids = append(ids, id)
+	}
+	logChannels.Info("频道只处理指定话题", "channel", channel.ID, "title", channel.Title, "topics", ids)
+	return nil
+}
+
+// resolveChannel 获取频道信息
+// 优先使用保存的 access hash，找不到时从对话列表中查找
+func resolveChannel(ctx context.Context, api *tg.Client, userID, channelID int64) (*tg.Channel, error) {
+	var accessHash int64
+	if accessHasher != nil {
+		if hash, found, err := accessHasher.GetChannelAccessHash(ctx, userID, channelID); err == nil && found {
+			accessHash = hash
+		}
+	}
+
+	chats, err := api.ChannelsGetChannels(ctx, []tg.InputChannelClass{
+		&tg.InputChannel{
+			ChannelID:  channelID,
+			AccessHash: accessHash,
+		},
+	})
+	if err == nil {
+		for _, chat := range chats.GetChats() {
+			switch ch := chat.(type) {
+			case *tg.Channel:
+				return ch, nil
+			case *tg.ChannelForbidden:
+				return nil, fmt.Errorf("频道 %d 无法访问: %s", channelID, ch.Title)
+			}
+		}
+	}
+
+	// 如果失败，尝试从对话中查找 AccessHash
+	dialogs, err := api.MessagesGetDialogs(ctx, &tg.MessagesGetDialogsRequest{
+		OffsetDate: 0,
+		OffsetID:   0,
+		OffsetPeer: &tg.InputPeerEmpty{},
+		Limit:      100,
+		Hash:       0,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取对话列表失败: %w", err)
+	}
+
+	modified, ok := dialogs.AsModified()
+	if ok {
+		for _, chat := range modified.GetChats() {
+			if ch, ok := chat.(*tg.Channel); ok && ch.ID == channelID {
+				if accessHasher != nil {
+					_ = accessHasher.SetChannelAccessHash(ctx, userID, ch.ID, ch.AccessHash)
+				}
+				return ch, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("未找到频道 %d，请确认已加入该频道", channelID)
+}
+
+// messageSource 消息来源
+type messageSource struct {
+	Kind      string // 频道 / 群组 / 私聊
+	PeerID    int64  // 消息实际所在的频道、群组或用户 ID
+	ChannelID int64  // 用于频道过滤的 ID，讨论组评论归属到所属频道
+	TopicID   int    // 论坛话题 ID，0 表示不在话题中
+	Comment   bool   // 是否是频道讨论组中的评论
+
+	// 转发来源，Forwarded 为 false 时其余字段无意义
+	Forwarded       bool
+	OriginChannelID int64  // 原始频道 ID
+	OriginPostID    int    // 原始频道中的消息 ID
+	OriginUserID    int64  // 原始发送用户 ID
+	OriginName      string // 隐藏了账号的原始发送者名称
+
+	// 发送者，频道自身或匿名管理员发布的消息 SenderID 为 0
+	SenderID       int64
+	SenderName     string
+	SenderUsername string
+	SenderBot      bool
+	SenderChannel  bool // 以频道身份发送，SenderID 是频道 ID
+}
+
+// resolveSource 解析消息来源
+// 返回 false 表示消息是频道帖子在讨论组中的自动转发副本，不需要重复处理
+func resolveSource(msg *tg.Message) (messageSource, bool) {
+	var src messageSource
+	switch peer := msg.PeerID.(type) {
+	case *tg.PeerChannel:
+		src.Kind = "频道"
+		src.PeerID = peer.ChannelID
+		src.ChannelID = peer.ChannelID
+	case *tg.PeerChat:
+		src.Kind = "群组"
+		src.PeerID = peer.ChatID
+	case *tg.PeerUser:
+		src.Kind = "私聊"
+		src.PeerID = peer.UserID
+	}
+
+	if header, ok := msg.ReplyTo.(*tg.MessageReplyHeader); ok && header.ForumTopic {
+		src.TopicID = header.ReplyToMsgID
+		if header.ReplyToTopID != 0 {
+			src.TopicID = header.ReplyToTopID
+		}
+	}
+
+	if fwd, ok := msg.GetFwdFrom(); ok {
+		src.Forwarded = true
+		src.OriginName = fwd.FromName
+		switch from := fwd.FromID.(type) {
+		case *tg.PeerChannel:
+			src.OriginChannelID = from.ChannelID
+			src.OriginPostID = fwd.ChannelPost
+		case *tg.PeerUser:
+			src.OriginUserID = from.UserID
+		}
+	}
+
+	if parent, ok := registry.discussionParent(src.PeerID); ok && src.Kind == "频道" {
+		if fwd, ok := msg.GetFwdFrom(); ok {
+			if saved, ok := fwd.SavedFromPeer.(*tg.PeerChannel); ok && saved.ChannelID == parent {
+				return src, false
+			}
+		}
+		src.ChannelID = parent
+		src.Comment = true
+	}
+
+	return src, true
+}
+
+// Label 返回用于输出的来源标签，如 频道:123/topic:45
+func (s messageSource) Label() string {
+	if s.Kind == "" {
+		return ""
+	}
+	label := fmt.Sprintf("%s:%d", s.Kind, s.PeerID)
+	if s.Comment {
+		label = fmt.Sprintf("频道:%d/comment", s.ChannelID)
+	}
+	if s.TopicID != 0 {
+		label += fmt.Sprintf("/topic:%d", s.TopicID)
+	}
+	return label
+}
+
+// OriginLabel 返回转发来源标签，如 频道:456/789，不是转发消息时返回空字符串
+func (s messageSource) OriginLabel() string {
+	switch {
+	case !s.Forwarded:
+		return ""
+	case s.OriginChannelID != 0 && s.OriginPostID != 0:
+		return fmt.Sprintf("频道:%d/%d", s.OriginChannelID, s.OriginPostID)
+	case s.OriginChannelID != 0:
+		return fmt.Sprintf("频道:%d", s.OriginChannelID)
+	case s.OriginUserID != 0:
+		return fmt.Sprintf("用户:%d", s.OriginUserID)
+	case s.OriginName != "":
+		return s.OriginName
+	default:
+		return "未知来源"
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/tg"
+
+	"simple-listener/internal/extractor"
+	"simple-listener/internal/filter"
+	"simple-listener/internal/sink"
+	"simple-listener/internal/store"
+)
+
+// controller 处理用户在收藏夹或控制群组中发送的命令
+type controller struct {
+	l         *listener
+	chat      string // me / 群组或频道 ID
+	proxies   *proxyPool
+	startedAt time.Time
+}
+
+func newController(l *listener, chat string, proxies *proxyPool) *controller {
+	if chat == "" {
+		chat = "me"
+	}
+	return &controller{l: l, chat: chat, proxies: proxies, startedAt: time.Now()}
+}
+
+// 命令帮助
+const commandHelp = `可用命令:
+/status - 运行状态
+/channels list|add|remove <@username|频道ID> - 管理监听频道
+/keyword list|add|remove <关键词> - 管理关键词
+/pause, /resume - 暂停或恢复处理消息
+/backfill <@username|频道ID> <条数> - 重新获取频道历史消息（最多 100 条）
+/retry-failed - 重新提交失败的链接
+/test <文本> - 测试过滤结果，不提交订阅`
+
+// retrySubmitTimeout /retry-failed 中每个链接的提交超时
+const retrySubmitTimeout = 30 * time.Second
+
+// isControlChat 判断对话是否是控制对话
+func (c *controller) isControlChat(peer tg.PeerClass) bool {
+	return targetMatches(c.chat, nil, peer)
+}
+
+// Handle 处理控制命令，返回 false 表示不是控制对话中的消息
+// 控制对话中的所有消息都不参与过滤，避免命令回复（如 /test 的结果）被当作订阅提交
+func (c *controller) Handle(ctx context.Context, msg *tg.Message) bool {
+	if !c.isControlChat(msg.PeerID) {
+		return false
+	}
+	if !msg.Out || !strings.HasPrefix(msg.Message, "/") {
+		return true
+	}
+
+	fields := strings.Fields(msg.Message)
+	name, args := fields[0], fields[1:]
+	logControl.Info("收到命令", "command", msg.Message)
+
+	reply := func(text string) {
+		if err := c.reply(ctx, msg, text); err != nil {
+			logControl.Warn("回复命令失败", "error", err)
+		}
+	}
+
+	switch name {
+	case "/status":
+		reply(c.status())
+	case "/channels":
+		reply(c.channels(ctx, args))
+	case "/keyword":
+		reply(c.keyword(args))
+	case "/pause":
+		c.l.paused.Store(true)
+		reply("⏸️ 已暂停处理消息")
+	case "/resume":
+		c.l.paused.Store(false)
+		reply("▶️ 已恢复处理消息")
+	case "/backfill":
+		// 获取历史消息较慢，在后台执行，完成后回复
+		go func() { reply(c.backfill(ctx, args)) }()
+	case "/retry-failed":
+		go func() { reply(c.retryFailed()) }()
+	case "/test":
+		text := strings.TrimSpace(strings.TrimPrefix(msg.Message, name))
+		if text == "" {
+			reply("用法: /test <文本>")
+			break
+		}
+		reply(c.l.testFilter(text).String())
+	default:
+		reply(commandHelp)
+	}
+	return true
+}
+
+// reply 回复命令消息
+func (c *controller) reply(ctx context.Context, msg *tg.Message, text string) error {
+	api := tgAPI.Load()
+	if api == nil {
+		return fmt.Errorf("客户端未就绪")
+	}
+
+	var peer tg.InputPeerClass = &tg.InputPeerSelf{}
+	if _, ok := msg.PeerID.(*tg.PeerUser); !ok {
+		var err error
+		if peer, err = inputPeerOf(ctx, msg.PeerID, nil); err != nil {
+			return err
+		}
+	}
+
+	return retryFloodWait(ctx, func() error {
+		_, err := api.MessagesSendMessage(ctx, &tg.MessagesSendMessageRequest{
+			Peer:      peer,
+			Message:   text,
+			RandomID:  randomID(),
+			ReplyTo:   &tg.InputReplyToMessage{ReplyToMsgID: msg.ID},
+			NoWebpage: true,
+		})
+		return err
+	})
+}
+
+// status 返回运行状态
+func (c *controller) status() string {
+	l := c.l
+	channelCount, keywordCount := len(l.monitorChannels()), len(l.pipeline.Config().Keywords)
+
+	state := "运行中"
+	if l.paused.Load() {
+		state = "已暂停"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "📊 状态: %s\n", state)
+	fmt.Fprintf(&b, "运行时间: %v\n", time.Since(c.startedAt).Round(time.Second))
+	fmt.Fprintf(&b, "代理: %s\n", c.proxies.Current())
+	fmt.Fprintf(&b, "监听频道: %d 个\n", channelCount)
+	fmt.Fprintf(&b, "关键词: %d 个\n", keywordCount)
+	if l.links != nil {
+		fmt.Fprintf(&b, "失败待重试: %d 条消息\n", len(l.links.FailedRecords()))
+	}
+	fmt.Fprintf(&b, "转发: %v / 通知: %v", l.forwards != nil, l.notices != nil)
+	if s := l.settings; s.SubscriptionAPIDryRun || s.ForwardDryRun || s.NotifyDryRun {
+		fmt.Fprintf(&b, "\n🧪 dry-run: 订阅 API %v / 转发 %v / 通知 %v", s.SubscriptionAPIDryRun, s.ForwardDryRun, s.NotifyDryRun)
+	}
+	return b.String()
+}
+
+// channels 处理 /channels 命令
+func (c *controller) channels(ctx context.Context, args []string) string {
+	if len(args) == 0 || args[0] == "list" {
+		return fmt.Sprintf("🎯 监听频道: %v", c.l.monitorChannels())
+	}
+	if len(args) < 2 || (args[0] != "add" && args[0] != "remove") {
+		return "用法: /channels add|remove <@username|频道ID>"
+	}
+
+	channelID, err := resolveChannelArg(ctx, args[1])
+	if err != nil {
+		return fmt.Sprintf("❌ %v", err)
+	}
+	channels, err := c.l.updateMonitorChannels(args[0] == "add", channelID)
+	if err != nil {
+		return fmt.Sprintf("⚠️ %v", err)
+	}
+	return fmt.Sprintf("✅ 监听频道: %v", channels)
+}
+
+// keyword 处理 /keyword 命令
+func (c *controller) keyword(args []string) string {
+	if len(args) == 0 || args[0] == "list" {
+		return fmt.Sprintf("📋 关键词: %v", c.l.pipeline.Config().Keywords)
+	}
+	if len(args) < 2 || (args[0] != "add" && args[0] != "remove") {
+		return "用法: /keyword add|remove <关键词>"
+	}
+
+	keywords, err := c.l.updateKeywords(args[0] == "add", strings.Join(args[1:], " "))
+	if err != nil {
+		return fmt.Sprintf("⚠️ %v", err)
+	}
+	return fmt.Sprintf("✅ 关键词: %v", keywords)
+}
+
+// backfill 处理 /backfill 命令
+func (c *controller) backfill(ctx context.Context, args []string) string {
+	if len(args) < 1 {
+		return "用法: /backfill <@username|频道ID> <条数>"
+	}
+	limit := 100
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return "❌ 条数必须是正整数"
+		}
+		limit = min(n, 100)
+	}
+
+	api := tgAPI.Load()
+	if api == nil {
+		return "❌ 客户端未就绪"
+	}
+	channelID, err := resolveChannelArg(ctx, args[0])
+	if err != nil {
+		return fmt.Sprintf("❌ %v", err)
+	}
+	matched, err := c.l.fetchChannelHistory(ctx, api, selfID.Load(), channelID, limit)
+	if err != nil {
+		return fmt.Sprintf("❌ 获取历史消息失败: %v", err)
+	}
+	return fmt.Sprintf("✅ 频道 %d 最近 %d 条消息中匹配到 %d 条", channelID, limit, matched)
+}
+
+// retryFailed 重新提交链接记录中提交失败的链接
+func (c *controller) retryFailed() string {
+	l := c.l
+	if l.links == nil {
+		return "❌ 链接记录未启用"
+	}
+	if l.settings.SubscriptionAPIDryRun {
+		return "🧪 dry-run 模式下不重试提交"
+	}
+
+	var submitted, failed int
+	for _, r := range l.links.FailedRecords() {
+		// 提交在锁外进行，结果通过 Update 写回，期间被编辑修改过状态的链接不覆盖
+		results := make(map[string]sink.Result)
+		for _, link := range r.Links {
+			if link.Status != store.Failed {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), retrySubmitTimeout)
+			result := l.pipeline.Sink().Submit(ctx, sink.Link{URL: link.URL, Source: r.Source, Origin: r.Origin})
+			cancel()
+			results[link.URL] = result
+			if result.Status == store.Failed {
+				failed++
+			} else {
+				submitted++
+			}
+			logSink.Info("重试提交链接", "link", link.URL, "status", result.Status, "message", result.Message)
+		}
+		_, err := l.links.Update(r.PeerID, r.MessageIDs[0], func(r *store.MessageRecord) {
+			for _, link := range r.Links {
+				if result, ok := results[link.URL]; ok && link.Status == store.Failed {
+					link.Status = result.Status
+					link.Message = result.Message
+					link.Time = time.Now()
+				}
+			}
+		})
+		if err != nil {
+			logStore.Error("保存链接记录失败", "error", err)
+		}
+	}
+	return fmt.Sprintf("🔁 重试完成: 成功 %d / 失败 %d", submitted, failed)
+}
+
+// filterResult 过滤测试结果
+type filterResult struct {
+	KeywordMatched bool          `json:"keyword_matched"`
+	ContentMatched bool          `json:"content_matched"`
+	Links          []string      `json:"links"`
+	Outcome        string        `json:"outcome"`
+	Trace          []filter.Step `json:"trace"`
+}
+
+// testFilter 按当前配置对文本执行关键词、二次过滤和链接提取，不提交订阅
+func (l *listener) testFilter(text string) filterResult {
+	cfg := l.pipeline.Config()
+	var verdict filter.Verdict
+	cfg.Apply(&verdict, filter.Message{Text: text})
+	_, keywordMatched := cfg.MatchKeyword(text)
+	_, contentMatched := cfg.MatchContent(text)
+	return filterResult{
+		KeywordMatched: keywordMatched,
+		ContentMatched: contentMatched,
+		Links:          extractor.Unique(cfg.LinkBlacklist.Extract(text)),
+		Outcome:        verdict.Outcome,
+		Trace:          verdict.Trace,
+	}
+}
+
+// String 返回用于回复命令的测试结果
+func (r filterResult) String() string {
+	yesNo := map[bool]string{true: "✅", false: "❌"}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "🧪 测试结果（不提交订阅）\n")
+	fmt.Fprintf(&b, "%s 关键词匹配\n", yesNo[r.KeywordMatched])
+	fmt.Fprintf(&b, "%s 二次内容过滤（白名单频道跳过此项）\n", yesNo[r.ContentMatched])
+	fmt.Fprintf(&b, "提取到 %d 个链接", len(r.Links))
+	for _, link := range r.Links {
+		fmt.Fprintf(&b, "\n%s", link)
+	}
+	fmt.Fprintf(&b, "\n\n结果: %s", r.Outcome)
+	for _, s := range r.Trace {
+		fmt.Fprintf(&b, "\n%s", s)
+	}
+	return b.String()
+}
+
+// resolveChannelArg 将命令参数解析为频道 ID，支持 @username 和数字 ID
+func resolveChannelArg(ctx context.Context, arg string) (int64, error) {
+	if id, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		return id, nil
+	}
+	if !strings.HasPrefix(arg, "@") {
+		return 0, fmt.Errorf("无效的频道: %s", arg)
+	}
+
+	api := tgAPI.Load()
+	if api == nil {
+		return 0, fmt.Errorf("客户端未就绪")
+	}
+	resolved, err := api.ContactsResolveUsername(ctx, strings.TrimPrefix(arg, "@"))
+	if err != nil {
+		return 0, fmt.Errorf("解析 %s 失败: %w", arg, err)
+	}
+	for _, chat := range resolved.Chats {
+		if ch, ok := chat.(*tg.Channel); ok {
+			if accessHasher != nil {
+				_ = accessHasher.SetChannelAccessHash(ctx, selfID.Load(), ch.ID, ch.AccessHash)
+			}
+			return ch.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("%s 不是频道或群组", arg)
+}
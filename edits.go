@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/gotd/td/tg"
+
+	"simple-listener/internal/filter"
+	"simple-listener/internal/sink"
+	"simple-listener/internal/store"
+)
+
+// handleEdit 处理编辑后的消息
+// 按消息 ID 和 EditDate 判断版本，只提交编辑中新增的链接；
+// 开启 retract_on_edit 时，编辑中被移除的链接会通知订阅 API 撤回
+func (l *listener) handleEdit(ctx context.Context, msg *tg.Message, e tg.Entities) error {
+	if l.paused.Load() {
+		return nil
+	}
+
+	src, ok := resolveSource(msg)
+	if !ok {
+		return nil
+	}
+
+	record, found := l.links.Get(src.PeerID, msg.ID)
+	if !found {
+		// 相册还在等待合并，用编辑后的内容替换，合并时一起处理，避免同一链接提交两次
+		if msg.GroupedID != 0 && l.albums != nil && l.albums.Replace(msg) {
+			return nil
+		}
+		// 编辑前没有提取到链接，按新消息处理
+		l.processMessages(ctx, []*tg.Message{msg}, e.Users, time.Now().Format("15:04:05"))
+		return nil
+	}
+
+	// 同一版本的重复更新（例如重连后补齐）不再处理
+	if msg.EditDate <= record.EditDate {
+		return nil
+	}
+
+	timeLabel := time.Now().Format("15:04:05")
+	// 相册按合并后的内容过滤，其他消息使用记录中保存的文本
+	messages := albumMessages(record, msg)
+	src, messageText, links, verdict := l.filterMessages(ctx, messages, e.Users)
+	if verdict.Outcome == filter.Skipped {
+		// 来源、频道或发送者没有通过时拿不到消息内容，无法判断链接是否被移除，保持记录不变
+		return nil
+	}
+
+	// 新增的链接
+	var added []string
+	if verdict.Matched() {
+		for _, link := range links {
+			if !record.HasLink(link) {
+				added = append(added, link)
+			}
+		}
+	}
+	var submitted []*store.LinkRecord
+	if len(added) > 0 {
+		logFilter.Info("消息已编辑，新增链接", "source", record.Source, "message_id", msg.ID, "added", len(added))
+		submitted = l.submitLinks(ctx, src, timeLabel, added)
+	}
+
+	// 被移除的链接，相册中其他消息只保存了文本，无法判断文件等内容中的链接
+	changed := make(map[string]*store.LinkRecord)
+	if len(record.MessageIDs) == 1 {
+		current := make(map[string]bool)
+		for _, link := range l.pipeline.Config().LinkBlacklist.Extract(messageText) {
+			current[link] = true
+		}
+		for _, link := range record.Links {
+			if current[link.URL] || !removable(link.Status) {
+				continue
+			}
+			logFilter.Info("消息已编辑，移除了链接", "source", record.Source, "message_id", msg.ID, "link", link.URL)
+			link.Status = store.Removed
+			link.Time = time.Now()
+			changed[link.URL] = link
+			retractor, ok := l.pipeline.Sink().(sink.Retractor)
+			if !l.settings.RetractOnEdit || !ok {
+				continue
+			}
+			success, message := retractor.Retract(ctx, link.URL)
+			switch {
+			case l.settings.SubscriptionAPIDryRun:
+				link.Message = message
+			case success:
+				logSink.Info("订阅已撤回", "link", link.URL, "message", message)
+				link.Status = store.Retracted
+				link.Message = message
+				link.Time = time.Now()
+			default:
+				logSink.Error("订阅撤回失败", "link", link.URL, "message", message)
+			}
+		}
+	}
+
+	// 在记录锁内写回，不覆盖处理期间的删除标记和 /retry-failed 的结果
+	found, err := l.links.Update(src.PeerID, msg.ID, func(r *store.MessageRecord) {
+		if msg.EditDate > r.EditDate {
+			r.EditDate = msg.EditDate
+		}
+		if i := slices.Index(r.MessageIDs, msg.ID); i >= 0 && i < len(r.Texts) {
+			r.Texts[i] = msg.Message
+		}
+		for _, link := range r.Links {
+			if c, ok := changed[link.URL]; ok && removable(link.Status) {
+				*link = *c
+			}
+		}
+		for _, link := range submitted {
+			if !r.HasLink(link.URL) {
+				r.Links = append(r.Links, link)
+			}
+		}
+	})
+	if err != nil {
+		logStore.Error("保存链接记录失败", "error", err)
+	}
+	// 相册中其他消息只有文本，不更新归档
+	if found && len(record.MessageIDs) == 1 {
+		if updated, ok := l.links.Get(src.PeerID, msg.ID); ok {
+			l.archiveMessages(src, messages, messageText, verdict, updated.Links)
+		}
+	}
+	return nil
+}
+
+// removable 判断链接是否已提交，编辑中被移除时需要标记或撤回
+func removable(status string) bool {
+	return status == store.Submitted || status == store.Duplicate || status == store.DryRun
+}
+
+// albumMessages 返回编辑后的消息所在的整个相册，其他消息使用记录中保存的文本
+// 不是相册或记录中没有保存文本时只返回 msg
+func albumMessages(record *store.MessageRecord, msg *tg.Message) []*tg.Message {
+	if len(record.MessageIDs) <= 1 || len(record.Texts) != len(record.MessageIDs) {
+		return []*tg.Message{msg}
+	}
+	messages := make([]*tg.Message, len(record.MessageIDs))
+	for i, id := range record.MessageIDs {
+		if id == msg.ID {
+			messages[i] = msg
+			continue
+		}
+		m := *msg
+		m.ID = id
+		m.Message = record.Texts[i]
+		m.Media = nil
+		m.Entities = nil
+		messages[i] = &m
+	}
+	return messages
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"simple-listener/internal/config"
+	"simple-listener/internal/store"
+)
+
+// exportRow 导出的一条链接记录
+type exportRow struct {
+	Time      time.Time `json:"time"` // 消息发布时间
+	ChannelID int64     `json:"channel_id"`
+	Source    string    `json:"source"`
+	MessageID int       `json:"message_id"`
+	URL       string    `json:"url"`
+	Status    string    `json:"status"`
+	Message   string    `json:"message,omitempty"` // 订阅 API 的返回信息
+}
+
+// runExport export 子命令：导出链接记录或消息归档，返回退出码
+//
+//	simple-listener export [-from store|archive] [-format csv|jsonl|html] [-since 7d] [-until 2006-01-02] [-o 文件]
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: simple-listener export [选项]")
+		fs.PrintDefaults()
+	}
+	var (
+		from   = fs.String("from", "store", "数据来源：store（链接记录）或 archive（消息归档）")
+		format = fs.String("format", "csv", "输出格式：csv、jsonl 或 html")
+		since  = fs.String("since", "", "开始时间：2006-01-02、2006-01-02 15:04，或 7d、12h 表示最近一段时间")
+		until  = fs.String("until", "", "结束时间（不包含），只写日期时包含当天")
+		output = fs.String("o", "", "输出文件，默认输出到标准输出")
+	)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var (
+		start, end time.Time
+		err        error
+	)
+	now := time.Now()
+	if start, err = parseTimeArg(*since, now, false); err != nil {
+		fmt.Fprintf(os.Stderr, "-since: %v\n", err)
+		return 2
+	}
+	if end, err = parseTimeArg(*until, now, true); err != nil {
+		fmt.Fprintf(os.Stderr, "-until: %v\n", err)
+		return 2
+	}
+
+	var write func(io.Writer, []exportRow) error
+	switch *format {
+	case "csv":
+		write = writeExportCSV
+	case "jsonl":
+		write = writeExportJSONL
+	case "html":
+		write = func(w io.Writer, rows []exportRow) error {
+			return writeExportHTML(w, rows, start, end)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "不支持的格式: %s\n", *format)
+		return 2
+	}
+
+	c, err := config.Load(configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	s := newSettings(c)
+
+	var rows []exportRow
+	switch *from {
+	case "store":
+		rows, err = exportFromStore(s.StoreFile, start, end)
+	case "archive":
+		rows, err = exportFromArchive(s.ArchiveFile, start, end)
+	default:
+		fmt.Fprintf(os.Stderr, "不支持的数据来源: %s\n", *from)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		if out, err = os.Create(*output); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer out.Close()
+	}
+	w := bufio.NewWriter(out)
+	if err := write(w, rows); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// exportFromStore 从链接记录中读取时间范围内的链接
+func exportFromStore(path string, since, until time.Time) ([]exportRow, error) {
+	links, err := store.NewLinkStore(path, 0)
+	if err != nil {
+		return nil, err
+	}
+	var rows []exportRow
+	for _, r := range links.Between(since, until) {
+		// 旧记录没有保存频道 ID，使用消息所在的对话 ID
+		channelID := r.ChannelID
+		if channelID == 0 {
+			channelID = r.PeerID
+		}
+		for _, l := range r.Links {
+			rows = append(rows, exportRow{
+				Time:      time.Unix(int64(r.Date), 0),
+				ChannelID: channelID,
+				Source:    r.Source,
+				MessageID: r.MessageIDs[0],
+				URL:       l.URL,
+				Status:    l.Status,
+				Message:   l.Message,
+			})
+		}
+	}
+	return rows, nil
+}
+
+// exportFromArchive 从消息归档中读取时间范围内的链接，包括没有提交的链接
+func exportFromArchive(path string, since, until time.Time) ([]exportRow, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("归档数据库不存在: %s（需要在配置中开启 archive.enabled）", path)
+	}
+	a, err := store.OpenArchive(path, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer a.Close()
+
+	entries, err := a.Search(store.ArchiveQuery{Since: since, Until: until})
+	if err != nil {
+		return nil, err
+	}
+	var rows []exportRow
+	for i := len(entries) - 1; i >= 0; i-- { // 从旧到新
+		e := entries[i]
+		for _, l := range e.Links {
+			rows = append(rows, exportRow{
+				Time:      e.Date,
+				ChannelID: e.ChannelID,
+				Source:    e.Source,
+				MessageID: e.MessageIDs[0],
+				URL:       l.URL,
+				Status:    l.Status,
+			})
+		}
+	}
+	return rows, nil
+}
+
+// writeExportCSV 输出 CSV，第一行为表头
+func writeExportCSV(w io.Writer, rows []exportRow) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"time", "channel_id", "source", "message_id", "url", "status", "message"}); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		record := []string{
+			r.Time.Format(time.RFC3339),
+			strconv.FormatInt(r.ChannelID, 10),
+			r.Source,
+			strconv.Itoa(r.MessageID),
+			r.URL,
+			r.Status,
+			r.Message,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeExportJSONL 每行输出一个 JSON 对象
+func writeExportJSONL(w io.Writer, rows []exportRow) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, r := range rows {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reportGroup HTML 报告中按频道和日期分组的统计
+type reportGroup struct {
+	Source    string
+	ChannelID int64
+	Day       string
+	Submitted int
+	Duplicate int
+	Failed    int
+	Other     int // 其他状态（已移除、黑名单等）
+	Rows      []exportRow
+}
+
+// groupExportRows 按频道和日期（本地时间）分组，频道按名称、日期按时间排序
+func groupExportRows(rows []exportRow) []*reportGroup {
+	type key struct {
+		channelID int64
+		day       string
+	}
+	index := make(map[key]*reportGroup)
+	var groups []*reportGroup
+	for _, r := range rows {
+		k := key{r.ChannelID, r.Time.Format("2006-01-02")}
+		g, ok := index[k]
+		if !ok {
+			g = &reportGroup{Source: r.Source, ChannelID: r.ChannelID, Day: k.day}
+			index[k] = g
+			groups = append(groups, g)
+		}
+		switch r.Status {
+		case store.Submitted:
+			g.Submitted++
+		case store.Duplicate:
+			g.Duplicate++
+		case store.Failed:
+			g.Failed++
+		default:
+			g.Other++
+		}
+		g.Rows = append(g.Rows, r)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Source != groups[j].Source {
+			return groups[i].Source < groups[j].Source
+		}
+		if groups[i].ChannelID != groups[j].ChannelID {
+			return groups[i].ChannelID < groups[j].ChannelID
+		}
+		return groups[i].Day < groups[j].Day
+	})
+	return groups
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>订阅链接报告</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", "PingFang SC", "Microsoft YaHei", sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 4px 10px; text-align: left; }
+th { background: #f3f3f3; }
+td.num { text-align: right; }
+.submitted { color: #1a7f37; }
+.duplicate { color: #9a6700; }
+.failed { color: #cf222e; }
+details { margin: 0.5em 0; }
+summary { cursor: pointer; }
+</style>
+</head>
+<body>
+<h1>订阅链接报告</h1>
+<p>时间范围：{{.Range}}，生成时间：{{.Generated}}</p>
+<table>
+<tr><th>频道</th><th>日期</th><th>提交成功</th><th>已存在</th><th>失败</th><th>其他</th></tr>
+{{- range .Groups}}
+<tr><td>{{.Source}} ({{.ChannelID}})</td><td>{{.Day}}</td><td class="num submitted">{{.Submitted}}</td><td class="num duplicate">{{.Duplicate}}</td><td class="num failed">{{.Failed}}</td><td class="num">{{.Other}}</td></tr>
+{{- end}}
+<tr><th colspan="2">合计</th><th class="num">{{.Total.Submitted}}</th><th class="num">{{.Total.Duplicate}}</th><th class="num">{{.Total.Failed}}</th><th class="num">{{.Total.Other}}</th></tr>
+</table>
+<h2>明细</h2>
+{{- range .Groups}}
+<details>
+<summary>{{.Source}} ({{.ChannelID}}) {{.Day}}：{{len .Rows}} 个链接</summary>
+<table>
+<tr><th>时间</th><th>消息 ID</th><th>链接</th><th>结果</th><th>说明</th></tr>
+{{- range .Rows}}
+<tr><td>{{.Time.Format "15:04:05"}}</td><td>{{.MessageID}}</td><td>{{.URL}}</td><td class="{{.Status}}">{{.Status}}</td><td>{{.Message}}</td></tr>
+{{- end}}
+</table>
+</details>
+{{- end}}
+</body>
+</html>
+`))
+
+// writeExportHTML 输出按频道和日期分组的静态 HTML 报告
+func writeExportHTML(w io.Writer, rows []exportRow, since, until time.Time) error {
+	groups := groupExportRows(rows)
+	total := reportGroup{}
+	for _, g := range groups {
+		total.Submitted += g.Submitted
+		total.Duplicate += g.Duplicate
+		total.Failed += g.Failed
+		total.Other += g.Other
+	}
+
+	timeRange := "全部"
+	if !since.IsZero() || !until.IsZero() {
+		start, end := "最早", "现在"
+		if !since.IsZero() {
+			start = since.Format("2006-01-02 15:04")
+		}
+		if !until.IsZero() {
+			end = until.Format("2006-01-02 15:04")
+		}
+		timeRange = start + " ~ " + end
+	}
+
+	return reportTemplate.Execute(w, map[string]any{
+		"Range":     timeRange,
+		"Generated": time.Now().Format("2006-01-02 15:04:05"),
+		"Groups":    groups,
+		"Total":     total,
+	})
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+
+	"simple-listener/internal/config"
+)
+
+// 转发方式
+const (
+	forwardModeForward = "forward" // 直接转发原消息，频道禁止转发时改为复制
+	forwardModeCopy    = "copy"    // 按模板重新发送文本
+)
+
+// 默认复制模板
+const defaultForwardTemplate = `{{.Source}}{{if .Origin}} ← {{.Origin}}{{end}}{{if .Sender}} 👤 {{.Sender}}{{end}}
+{{range .Links}}{{.}}
+{{end}}{{if .Link}}{{.Link}}{{end}}`
+
+// forwardData 复制模板中可用的字段
+type forwardData struct {
+	Source string   // 来源标签，如 频道:123/topic:45
+	Origin string   // 转发来源，不是转发消息时为空
+	Sender string   // 发送者，频道自身发布的消息为空
+	Text   string   // 消息内容
+	Links  []string // 提取到的链接
+	Link   string   // 原消息链接，只有频道和超级群组才有
+	Time   string   // 消息时间
+}
+
+// forwardJob 等待转发的消息
+type forwardJob struct {
+	from       tg.InputPeerClass
+	messageIDs []int
+	text       string // 按模板生成的文本，复制时使用
+}
+
+// forwarder 将匹配的消息转发或复制到目标对话，按固定间隔发送以避免触发 FLOOD_WAIT
+type forwarder struct {
+	target    string
+	mode      string
+	interval  time.Duration
+	template  *template.Template
+	templates map[int64]*template.Template // 频道 ID -> 频道自定义模板
+	jobs      chan forwardJob
+	dryRun    bool // 只记录日志，不实际发送
+
+	mu   sync.Mutex
+	peer tg.InputPeerClass // 解析后的目标对话
+}
+
+// newForwarder 创建转发器，rate 为每分钟最多发送的消息数
+func newForwarder(target, mode, text string, rate int, options map[int64]config.ChannelOptions) (*forwarder, error) {
+	if mode == "" {
+		mode = forwardModeForward
+	}
+	if mode != forwardModeForward && mode != forwardModeCopy {
+		return nil, fmt.Errorf("不支持的转发方式: %s", mode)
+	}
+	if text == "" {
+		text = defaultForwardTemplate
+	}
+	if rate <= 0 {
+		rate = 20
+	}
+	if strings.TrimSpace(target) == "" {
+		return nil, fmt.Errorf("没有设置转发目标 forward.target（me / @username / 频道 ID）")
+	}
+
+	f := &forwarder{
+		target:    strings.TrimSpace(target),
+		mode:      mode,
+		interval:  time.Minute / time.Duration(rate),
+		templates: make(map[int64]*template.Template),
+		jobs:      make(chan forwardJob, 100),
+	}
+
+	var err error
+	if f.template, err = template.New("forward").Parse(text); err != nil {
+		return nil, fmt.Errorf("解析转发模板失败: %w", err)
+	}
+	for channelID, opts := range options {
+		if opts.ForwardTemplate == "" {
+			continue
+		}
+		tmpl, err := template.New(strconv.FormatInt(channelID, 10)).Parse(opts.ForwardTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("解析频道 %d 的转发模板失败: %w", channelID, err)
+		}
+		f.templates[channelID] = tmpl
+	}
+	return f, nil
+}
+
+// Enqueue 加入转发队列，队列已满时丢弃并输出警告
+func (f *forwarder) Enqueue(messages []*tg.Message, users map[int64]*tg.User, src messageSource, text string, links []string) {
+	from, err := inputPeerOf(context.Background(), messages[0].PeerID, users)
+	if err != nil {
+		logSink.Warn("无法转发", "source", src.Label(), "error", err)
+		return
+	}
+
+	job := forwardJob{from: from}
+	for _, m := range messages {
+		job.messageIDs = append(job.messageIDs, m.ID)
+	}
+	job.text, err = f.render(src, forwardData{
+		Source: src.Label(),
+		Origin: src.OriginLabel(),
+		Sender: src.SenderLabel(),
+		Text:   text,
+		Links:  links,
+		Link:   messageLink(src, messages[0].ID),
+		Time:   time.Unix(int64(messages[0].Date), 0).Format("2006-01-02 15:04:05"),
+	})
+	if err != nil {
+		logSink.Warn("生成转发内容失败", "source", src.Label(), "error", err)
+		return
+	}
+
+	select {
+	case f.jobs <- job:
+	default:
+		logSink.Warn("转发队列已满，跳过", "source", src.Label())
+	}
+}
+
+// Pending 返回等待转发的消息数
+func (f *forwarder) Pending() int {
+	return len(f.jobs)
+}
+
+// render 按频道模板生成复制文本，频道没有自定义模板时使用全局模板
+func (f *forwarder) render(src messageSource, data forwardData) (string, error) {
+	tmpl, ok := f.templates[src.PeerID]
+	if !ok {
+		tmpl, ok = f.templates[src.ChannelID]
+	}
+	if !ok {
+		tmpl = f.template
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// Run 按间隔依次发送队列中的消息，直到 ctx 结束
+func (f *forwarder) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-f.jobs:
+			f.send(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// send 发送一条转发任务，遇到 FLOOD_WAIT 时等待后重试
+func (f *forwarder) send(ctx context.Context, job forwardJob) {
+	if err := retryFloodWait(ctx, func() error { return f.deliver(ctx, job) }); err != nil {
+		logSink.Error("转发消息失败", "error", err)
+	}
+}
+
+// retryFloodWait 执行 fn，遇到 FLOOD_WAIT 时等待指定时间后重试
+func retryFloodWait(ctx context.Context, fn func() error) error {
+	for {
+		err := fn()
+		wait, ok := tgerr.AsFloodWait(err)
+		if !ok {
+			return err
+		}
+		logSink.Warn("触发 Telegram 限流", "wait", wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait + time.Second):
+		}
+	}
+}
+
+// deliver 转发消息，频道禁止转发时改为复制文本
+func (f *forwarder) deliver(ctx context.Context, job forwardJob) error {
+	if f.dryRun {
+		logSink.Info("[dry-run] 转发未发送", "dry_run", true, "target", f.target, "mode", f.mode, "messages", job.messageIDs, "text", job.text)
+		metricDryRunRequests.WithLabelValues("forward").Inc()
+		return nil
+	}
+
+	api := tgAPI.Load()
+	if api == nil {
+		return fmt.Errorf("客户端未就绪")
+	}
+	to, err := f.resolveTarget(ctx, api)
+	if err != nil {
+		return err
+	}
+
+	if f.mode == forwardModeForward {
+		randomIDs := make([]int64, len(job.messageIDs))
+		for i := range randomIDs {
+			randomIDs[i] = randomID()
+		}
+		_, err := api.MessagesForwardMessages(ctx, &tg.MessagesForwardMessagesRequest{
+			FromPeer: job.from,
+			ID:       job.messageIDs,
+			RandomID: randomIDs,
+			ToPeer:   to,
+		})
+		if !tg.IsChatForwardsRestricted(err) {
+			return err
+		}
+	}
+
+	_, err = api.MessagesSendMessage(ctx, &tg.MessagesSendMessageRequest{
+		Peer:      to,
+		Message:   job.text,
+		RandomID:  randomID(),
+		NoWebpage: true,
+	})
+	return err
+}
+
+// resolveTarget 解析转发目标，解析结果会被缓存
+func (f *forwarder) resolveTarget(ctx context.Context, api *tg.Client) (tg.InputPeerClass, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.peer != nil {
+		return f.peer, nil
+	}
+
+	peer, err := resolvePeer(ctx, api, f.target)
+	if err != nil {
+		return nil, fmt.Errorf("解析转发目标失败: %w", err)
+	}
+	f.peer = peer
+
+	logSink.Info("已解析转发目标", "target", f.target)
+	return f.peer, nil
+}
+
+// isTarget 判断对话是否是转发目标
+func (f *forwarder) isTarget(peer tg.PeerClass) bool {
+	f.mu.Lock()
+	resolved := f.peer
+	f.mu.Unlock()
+	return targetMatches(f.target, resolved, peer)
+}
+
+// resolvePeer 解析消息发送目标，支持 me（收藏夹）、@username 和频道 ID
+func resolvePeer(ctx context.Context, api *tg.Client, target string) (tg.InputPeerClass, error) {
+	target = strings.TrimSpace(target)
+	switch {
+	case strings.EqualFold(target, "me"):
+		return &tg.InputPeerSelf{}, nil
+	case strings.HasPrefix(target, "@"):
+		resolved, err := api.ContactsResolveUsername(ctx, strings.TrimPrefix(target, "@"))
+		if err != nil {
+			return nil, err
+		}
+		for _, chat := range resolved.Chats {
+			if ch, ok := chat.(*tg.Channel); ok {
+				return ch.AsInputPeer(), nil
+			}
+		}
+		for _, user := range resolved.Users {
+			if u, ok := user.(*tg.User); ok {
+				return u.AsInputPeer(), nil
+			}
+		}
+		return nil, fmt.Errorf("未找到 %s", target)
+	default:
+		channelID, err := strconv.ParseInt(target, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("无效的目标: %s", target)
+		}
+		channel, err := resolveChannel(ctx, api, selfID.Load(), channelID)
+		if err != nil {
+			return nil, err
+		}
+		return channel.AsInputPeer(), nil
+	}
+}
+
+// targetMatches 判断对话是否是 target（me / @username / 频道 ID）指定的发送目标
+// @username 需要解析后才能判断，resolved 为已解析的目标，还没有解析时为 nil
+func targetMatches(target string, resolved tg.InputPeerClass, peer tg.PeerClass) bool {
+	target = strings.TrimSpace(target)
+	if strings.EqualFold(target, "me") {
+		p, ok := peer.(*tg.PeerUser)
+		return ok && p.UserID == selfID.Load()
+	}
+	if id, err := strconv.ParseInt(target, 10, 64); err == nil {
+		switch p := peer.(type) {
+		case *tg.PeerChannel:
+			return p.ChannelID == id
+		case *tg.PeerChat:
+			return p.ChatID == id
+		}
+		return false
+	}
+
+	switch r := resolved.(type) {
+	case *tg.InputPeerChannel:
+		p, ok := peer.(*tg.PeerChannel)
+		return ok && p.ChannelID == r.ChannelID
+	case *tg.InputPeerUser:
+		p, ok := peer.(*tg.PeerUser)
+		return ok && p.UserID == r.UserID
+	}
+	return false
+}
+
+// inputPeerOf 将消息所在对话转换为 InputPeer，频道使用保存的 access hash
+func inputPeerOf(ctx context.Context, peer tg.PeerClass, users map[int64]*tg.User) (tg.InputPeerClass, error) {
+	switch p := peer.(type) {
+	case *tg.PeerChannel:
+		if accessHasher == nil {
+			return nil, fmt.Errorf("频道 %d 没有 access hash", p.ChannelID)
+		}
+		hash, found, err := accessHasher.GetChannelAccessHash(ctx, selfID.Load(), p.ChannelID)
+		if err != nil || !found {
+			return nil, fmt.Errorf("频道 %d 没有 access hash", p.ChannelID)
+		}
+		return &tg.InputPeerChannel{ChannelID: p.ChannelID, AccessHash: hash}, nil
+	case *tg.PeerChat:
+		return &tg.InputPeerChat{ChatID: p.ChatID}, nil
+	case *tg.PeerUser:
+		user, ok := users[p.UserID]
+		if !ok {
+			return nil, fmt.Errorf("用户 %d 没有 access hash", p.UserID)
+		}
+		return user.AsInputPeer(), nil
+	}
+	return nil, fmt.Errorf("未知的对话类型: %T", peer)
+}
+
+// messageLink 返回频道消息的 t.me 链接，不是频道消息时返回空字符串
+func messageLink(src messageSource, messageID int) string {
+	if src.Kind != "频道" {
+		return ""
+	}
+	return fmt.Sprintf("https://t.me/c/%d/%d", src.PeerID, messageID)
+}
+
+// randomID 生成发送消息所需的随机 ID
+func randomID() int64 {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return int64(binary.LittleEndian.Uint64(b[:]))
+}
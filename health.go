@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// healthState 连接、登录和 updates 的运行状态，供 /healthz 和 /readyz 使用
+type healthState struct {
+	mu          sync.Mutex
+	connected   bool      // MTProto 连接已建立
+	authorized  bool      // 已完成登录
+	gapsStarted bool      // gaps 已开始接收更新
+	changedAt   time.Time // 上次状态变化的时间
+	lastUpdate  time.Time // 最近一次收到更新的时间
+}
+
+var health = &healthState{changedAt: time.Now()}
+
+// healthReport 健康检查结果
+type healthReport struct {
+	Status          string     `json:"status"`
+	Reason          string     `json:"reason,omitempty"`
+	Connected       bool       `json:"connected"`
+	Authorized      bool       `json:"authorized"`
+	GapsStarted     bool       `json:"gaps_started"`
+	LastUpdate      *time.Time `json:"last_update,omitempty"`
+	SinceLastUpdate string     `json:"since_last_update,omitempty"`
+}
+
+// setConnected 记录 MTProto 连接已建立
+func (h *healthState) setConnected() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.connected = true
+	h.changedAt = time.Now()
+}
+
+// setAuthorized 记录登录完成
+func (h *healthState) setAuthorized() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.authorized = true
+	h.changedAt = time.Now()
+}
+
+// setGapsStarted 记录 gaps 已启动，从此刻开始计算无更新时间
+func (h *healthState) setGapsStarted() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.gapsStarted = true
+	h.changedAt = time.Now()
+	h.lastUpdate = h.changedAt
+}
+
+// reset 连接断开后清除状态
+func (h *healthState) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.connected, h.authorized, h.gapsStarted = false, false, false
+	h.changedAt = time.Now()
+}
+
+// touch 记录收到更新
+func (h *healthState) touch() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastUpdate = time.Now()
+}
+
+// check 检查状态
+// ready 表示连接、登录和 gaps 都已就绪
+// healthy 为 false 表示未就绪超过 readyTimeout，或就绪后超过 updateWindow 没有收到任何更新，需要重启
+// 已连接、等待登录时可能在终端输入验证码，不按 readyTimeout 判断为卡住，避免首次登录时被重启
+// 参数为 0 时不检查对应的超时；没有消息的账号可能长时间收不到更新，updateWindow 默认不检查
+func (h *healthState) check(readyTimeout, updateWindow time.Duration) (report healthReport, ready, healthy bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	report = healthReport{
+		Connected:   h.connected,
+		Authorized:  h.authorized,
+		GapsStarted: h.gapsStarted,
+	}
+	if !h.lastUpdate.IsZero() {
+		last := h.lastUpdate
+		report.LastUpdate = &last
+		report.SinceLastUpdate = time.Since(last).Round(time.Second).String()
+	}
+
+	ready = h.connected && h.authorized && h.gapsStarted
+	healthy = true
+	switch {
+	case !h.connected:
+		report.Reason = "未连接到 Telegram"
+	case !h.authorized:
+		report.Reason = "未完成登录"
+	case !h.gapsStarted:
+		report.Reason = "gaps 未启动"
+	}
+	switch {
+	case !ready && h.authorizing():
+		// 等待登录，视为健康
+	case !ready && readyTimeout > 0 && time.Since(h.changedAt) > readyTimeout:
+		healthy = false
+		report.Reason += "，已持续 " + time.Since(h.changedAt).Round(time.Second).String()
+	case ready && updateWindow > 0 && time.Since(h.lastUpdate) > updateWindow:
+		healthy = false
+		report.Reason = "超过 " + updateWindow.String() + " 没有收到更新"
+	}
+	return report, ready, healthy
+}
+
+// authorizing 是否已连接、正在等待登录完成（调用方需持有锁）
+func (h *healthState) authorizing() bool {
+	return h.connected && !h.authorized
+}
+
+// healthHandler 返回 /healthz 和 /readyz 接口
+// /healthz 用于存活检查，连接卡住时返回 503，由 Docker/Kubernetes/systemd 重启；等待登录时返回 200，状态为 authorizing
+// /readyz 用于就绪检查，连接、登录和 gaps 都就绪时返回 200
+func healthHandler(readyTimeout, updateWindow time.Duration) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		report, _, healthy := health.check(readyTimeout, updateWindow)
+		status := http.StatusOK
+		report.Status = "ok"
+		if report.Connected && !report.Authorized {
+			report.Status = "authorizing"
+		}
+		if !healthy {
+			status = http.StatusServiceUnavailable
+			report.Status = "stalled"
+		}
+		writeJSON(w, status, report)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		report, ready, _ := health.check(readyTimeout, updateWindow)
+		status := http.StatusOK
+		report.Status = "ready"
+		if !ready {
+			status = http.StatusServiceUnavailable
+			report.Status = "not ready"
+		}
+		writeJSON(w, status, report)
+	})
+	return mux
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthz(t *testing.T) {
+	tests := []struct {
+		name   string
+		state  *healthState
+		code   int
+		status string
+	}{
+		{"启动中", &healthState{changedAt: time.Now()}, http.StatusOK, "ok"},
+		{"连接卡住", &healthState{changedAt: time.Now().Add(-time.Hour)}, http.StatusServiceUnavailable, "stalled"},
+		{"等待登录", &healthState{connected: true, changedAt: time.Now().Add(-time.Hour)}, http.StatusOK, "authorizing"},
+		{"gaps 卡住", &healthState{connected: true, authorized: true, changedAt: time.Now().Add(-time.Hour)}, http.StatusServiceUnavailable, "stalled"},
+		{"就绪", &healthState{connected: true, authorized: true, gapsStarted: true, lastUpdate: time.Now()}, http.StatusOK, "ok"},
+	}
+	old := health
+	t.Cleanup(func() { health = old })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			health = tt.state
+			w := httptest.NewRecorder()
+			healthHandler(time.Minute, 0).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			var report healthReport
+			if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != tt.code || report.Status != tt.status {
+				t.Errorf("/healthz = %d %s, want %d %s", w.Code, report.Status, tt.code, tt.status)
+			}
+		})
+	}
+}
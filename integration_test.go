@@ -0,0 +1,649 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"simple-listener/internal/config"
+	"simple-listener/internal/faketg"
+	"simple-listener/internal/sink"
+	"simple-listener/internal/store"
+)
+
+const testChannelID = 1234567890
+
+func TestMain(m *testing.M) {
+	// 测试中只输出错误日志
+	setLoggers(slog.NewTextHandler(io.Discard, nil), slog.LevelError, nil)
+	os.Exit(m.Run())
+}
+
+// fakeSink 记录提交和撤回的链接
+type fakeSink struct {
+	mu        sync.Mutex
+	submitted []sink.Link
+	retracted []string
+}
+
+func (s *fakeSink) Submit(ctx context.Context, link sink.Link) sink.Result {
+	if err := ctx.Err(); err != nil {
+		return sink.Result{URL: link.URL, Status: store.Failed, Message: err.Error()}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.submitted = append(s.submitted, link)
+	return sink.Result{URL: link.URL, Status: store.Submitted, Message: "添加成功"}
+}
+
+func (s *fakeSink) Retract(_ context.Context, url string) (bool, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retracted = append(s.retracted, url)
+	return true, "已撤回"
+}
+
+// URLs 返回提交过的链接
+func (s *fakeSink) URLs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var urls []string
+	for _, l := range s.submitted {
+		urls = append(urls, l.URL)
+	}
+	return urls
+}
+
+// testConfig 测试使用的配置文件，控制命令修改后写回
+const testConfig = `monitor:
+  channels:
+    - 1234567890
+
+filters:
+  keywords:
+    - 订阅
+  content_filter:
+    - 投稿
+  link_blacklist:
+    - t.me
+`
+
+// newTestListener 按测试配置创建 listener，返回推送到其注册的 dispatcher 的更新源
+func newTestListener(t *testing.T) (*listener, *faketg.Feed, *fakeSink) {
+	t.Helper()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(testConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	links, err := store.NewLinkStore(filepath.Join(dir, "links.json"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeSink{}
+	l := newListener(path, c, newSettings(c), links, fake)
+
+	dispatcher := tg.NewUpdateDispatcher()
+	l.registerHandlers(dispatcher)
+	return l, faketg.NewFeed(dispatcher), fake
+}
+
+func TestNewChannelMessageToSink(t *testing.T) {
+	tests := []struct {
+		name      string
+		channelID int64
+		text      string
+		want      []string
+	}{
+		{"提交链接", testChannelID, "投稿订阅 https://example.com/sub", []string{"https://example.com/sub"}},
+		{"多个链接去掉黑名单和重复", testChannelID, "投稿订阅\nhttps://example.com/a https://t.me/x\nhttps://example.com/b https://example.com/a", []string{"https://example.com/a", "https://example.com/b"}},
+		{"不在监听列表中的频道", 42, "投稿订阅 https://example.com/sub", nil},
+		{"没有关键词", testChannelID, "投稿 https://example.com/sub", nil},
+		{"没有通过二次过滤", testChannelID, "订阅 https://example.com/sub", nil},
+		{"链接都在黑名单中", testChannelID, "投稿订阅 https://t.me/sub", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, feed, fake := newTestListener(t)
+			if err := feed.NewChannelMessage(context.Background(), faketg.ChannelMessage(tt.channelID, 1, tt.text)); err != nil {
+				t.Fatal(err)
+			}
+			if got := fake.URLs(); !slices.Equal(got, tt.want) {
+				t.Errorf("提交了 %q, want %q", got, tt.want)
+			}
+
+			record, found := l.links.Get(tt.channelID, 1)
+			if found != (len(tt.want) > 0) {
+				t.Fatalf("链接记录 found = %v", found)
+			}
+			if found {
+				if record.Source != "频道:1234567890" || len(record.Links) != len(tt.want) || record.Links[0].Status != store.Submitted {
+					t.Errorf("链接记录 = %+v", record)
+				}
+			}
+		})
+	}
+}
+
+func TestSinkReceivesSource(t *testing.T) {
+	_, feed, fake := newTestListener(t)
+	msg := faketg.ChannelMessage(testChannelID, 7, "投稿订阅 https://example.com/sub")
+	msg.SetFwdFrom(tg.MessageFwdHeader{FromID: &tg.PeerChannel{ChannelID: 555}, Date: msg.Date})
+	if err := feed.NewChannelMessage(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	want := []sink.Link{{URL: "https://example.com/sub", Source: "频道:1234567890", Origin: "频道:555"}}
+	if !slices.Equal(fake.submitted, want) {
+		t.Errorf("Sink 收到 %+v, want %+v", fake.submitted, want)
+	}
+}
+
+func TestEntitiesSenderFilter(t *testing.T) {
+	l, feed, fake := newTestListener(t)
+	l.settings.ChannelOptions = map[int64]config.ChannelOptions{
+		testChannelID: {DenySenders: []string{"@spammer"}},
+	}
+	// 用户名只在更新携带的 Entities 中
+	feed.AddUser(&tg.User{ID: 1, Username: "spammer"})
+	feed.AddUser(&tg.User{ID: 2, Username: "alice"})
+
+	ctx := context.Background()
+	if err := feed.NewChannelMessage(ctx, faketg.UserMessage(testChannelID, 1, 1, "投稿订阅 https://example.com/spam")); err != nil {
+		t.Fatal(err)
+	}
+	if err := feed.NewChannelMessage(ctx, faketg.UserMessage(testChannelID, 2, 2, "投稿订阅 https://example.com/sub")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.URLs(), []string{"https://example.com/sub"}; !slices.Equal(got, want) {
+		t.Errorf("提交了 %q, want %q", got, want)
+	}
+}
+
+func TestAlbum(t *testing.T) {
+	l, feed, fake := newTestListener(t)
+	l.albums = newAlbumBuffer(50 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	for _, m := range []*tg.Message{
+		faketg.ChannelMessage(testChannelID, 50, "投稿订阅"),
+		faketg.ChannelMessage(testChannelID, 51, "https://example.com/a"),
+	} {
+		m.SetGroupedID(7)
+		if err := feed.NewChannelMessage(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 更新处理器返回后 ctx 可能已经结束，不影响相册合并后的提交
+	cancel()
+
+	// 合并前编辑相册中的消息，合并时使用编辑后的内容
+	edited := faketg.ChannelMessage(testChannelID, 51, "https://example.com/a https://example.com/b")
+	edited.SetGroupedID(7)
+	if err := feed.EditChannelMessage(context.Background(), edited); err != nil {
+		t.Fatal(err)
+	}
+
+	var record *store.MessageRecord
+	for deadline := time.Now().Add(2 * time.Second); record == nil && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		record, _ = l.links.Get(testChannelID, 50)
+	}
+	if record == nil {
+		t.Fatal("相册没有被处理")
+	}
+	if got, want := fake.URLs(), []string{"https://example.com/a", "https://example.com/b"}; !slices.Equal(got, want) {
+		t.Errorf("提交了 %q, want %q", got, want)
+	}
+	if !slices.Equal(record.MessageIDs, []int{50, 51}) {
+		t.Errorf("MessageIDs = %v", record.MessageIDs)
+	}
+	for _, l := range record.Links {
+		if l.Status != store.Submitted {
+			t.Errorf("链接 %s 状态 = %s", l.URL, l.Status)
+		}
+	}
+}
+
+func TestEditChannelMessage(t *testing.T) {
+	l, feed, fake := newTestListener(t)
+	l.settings.RetractOnEdit = true
+	ctx := context.Background()
+
+	msg := faketg.ChannelMessage(testChannelID, 10, "投稿订阅 https://example.com/a")
+	if err := feed.NewChannelMessage(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	// 编辑后新增链接，只提交新增的链接
+	edited := faketg.ChannelMessage(testChannelID, 10, "投稿订阅 https://example.com/a https://example.com/b")
+	edited.SetEditDate(msg.Date + 1)
+	if err := feed.EditChannelMessage(ctx, edited); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.URLs(), []string{"https://example.com/a", "https://example.com/b"}; !slices.Equal(got, want) {
+		t.Errorf("提交了 %q, want %q", got, want)
+	}
+
+	// 同一版本的重复更新不再处理
+	if err := feed.EditChannelMessage(ctx, edited); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.submitted) != 2 {
+		t.Errorf("重复的编辑更新提交了链接: %q", fake.URLs())
+	}
+
+	// 编辑后移除链接，通知 Sink 撤回
+	removed := faketg.ChannelMessage(testChannelID, 10, "投稿订阅 https://example.com/b")
+	removed.SetEditDate(msg.Date + 2)
+	if err := feed.EditChannelMessage(ctx, removed); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"https://example.com/a"}; !slices.Equal(fake.retracted, want) {
+		t.Errorf("撤回了 %q, want %q", fake.retracted, want)
+	}
+
+	record, ok := l.links.Get(testChannelID, 10)
+	if !ok {
+		t.Fatal("没有链接记录")
+	}
+	statuses := make(map[string]string)
+	for _, l := range record.Links {
+		statuses[l.URL] = l.Status
+	}
+	if statuses["https://example.com/a"] != store.Retracted || statuses["https://example.com/b"] != store.Submitted {
+		t.Errorf("链接状态 = %v", statuses)
+	}
+}
+
+func TestEditSkippedMessage(t *testing.T) {
+	l, feed, fake := newTestListener(t)
+	l.settings.RetractOnEdit = true
+	ctx := context.Background()
+
+	msg := faketg.ChannelMessage(testChannelID, 15, "投稿订阅 https://example.com/a")
+	if err := feed.NewChannelMessage(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	// 频道被移出监听列表后，编辑不会把链接当作已移除
+	if _, err := l.updateMonitorChannels(true, 42); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.updateMonitorChannels(false, testChannelID); err != nil {
+		t.Fatal(err)
+	}
+	edited := faketg.ChannelMessage(testChannelID, 15, "投稿订阅 https://example.com/a")
+	edited.SetEditDate(msg.Date + 1)
+	if err := feed.EditChannelMessage(ctx, edited); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.retracted) != 0 {
+		t.Errorf("撤回了 %q", fake.retracted)
+	}
+	record, ok := l.links.Get(testChannelID, 15)
+	if !ok || record.EditDate != 0 || record.Links[0].Status != store.Submitted {
+		t.Errorf("链接记录 = %+v, 应保持不变", record)
+	}
+}
+
+func TestEditUnmatchedMessage(t *testing.T) {
+	_, feed, fake := newTestListener(t)
+	ctx := context.Background()
+
+	// 编辑前没有链接，编辑后按新消息处理
+	if err := feed.NewChannelMessage(ctx, faketg.ChannelMessage(testChannelID, 20, "投稿订阅，链接稍后更新")); err != nil {
+		t.Fatal(err)
+	}
+	if err := feed.EditChannelMessage(ctx, faketg.ChannelMessage(testChannelID, 20, "投稿订阅 https://example.com/later")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.URLs(), []string{"https://example.com/later"}; !slices.Equal(got, want) {
+		t.Errorf("提交了 %q, want %q", got, want)
+	}
+}
+
+func TestDeleteChannelMessages(t *testing.T) {
+	l, feed, _ := newTestListener(t)
+	ctx := context.Background()
+
+	if err := feed.NewChannelMessage(ctx, faketg.ChannelMessage(testChannelID, 30, "投稿订阅 https://example.com/sub")); err != nil {
+		t.Fatal(err)
+	}
+	if err := feed.DeleteChannelMessages(ctx, testChannelID, 30, 31); err != nil {
+		t.Fatal(err)
+	}
+	record, ok := l.links.Get(testChannelID, 30)
+	if !ok || !record.Deleted || record.DeletedAt == nil {
+		t.Errorf("链接记录 = %+v, 应标记为已删除", record)
+	}
+}
+
+func TestFetchChannelHistory(t *testing.T) {
+	l, _, fake := newTestListener(t)
+	api := faketg.NewAPI()
+	api.AddChannel(&tg.Channel{ID: testChannelID, AccessHash: 1, Title: "测试频道"})
+	api.AddHistory(testChannelID,
+		faketg.ChannelMessage(testChannelID, 1, "投稿订阅 https://example.com/1"),
+		faketg.ChannelMessage(testChannelID, 2, "没有关键词 https://example.com/2"),
+		faketg.ChannelMessage(testChannelID, 3, "投稿订阅 https://example.com/3"),
+	)
+
+	matched, err := l.fetchChannelHistory(context.Background(), api.Client(), 1, testChannelID, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if matched != 2 {
+		t.Errorf("matched = %d, want 2", matched)
+	}
+	// 从旧到新处理
+	if got, want := fake.URLs(), []string{"https://example.com/1", "https://example.com/3"}; !slices.Equal(got, want) {
+		t.Errorf("提交了 %q, want %q", got, want)
+	}
+	if got, want := api.Requests(), []string{"channels.getChannels", "messages.getHistory"}; !slices.Equal(got, want) {
+		t.Errorf("请求 = %q, want %q", got, want)
+	}
+
+	// 频道不存在
+	if _, err := l.fetchChannelHistory(context.Background(), api.Client(), 1, 42, 100); err == nil {
+		t.Error("不存在的频道应返回错误")
+	}
+}
+
+func TestRetryFailed(t *testing.T) {
+	l, _, fake := newTestListener(t)
+	record := &store.MessageRecord{
+		PeerID:     testChannelID,
+		MessageIDs: []int{40},
+		Source:     "频道:1234567890",
+		Links: []*store.LinkRecord{
+			{URL: "https://example.com/ok", Status: store.Submitted},
+			{URL: "https://example.com/failed", Status: store.Failed},
+		},
+	}
+	if err := l.links.Save(record); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := newController(l, "", nil).retryFailed(), "🔁 重试完成: 成功 1 / 失败 0"; got != want {
+		t.Errorf("retryFailed() = %q, want %q", got, want)
+	}
+	if got, want := fake.URLs(), []string{"https://example.com/failed"}; !slices.Equal(got, want) {
+		t.Errorf("提交了 %q, want %q", got, want)
+	}
+	if failed := l.links.FailedRecords(); len(failed) != 0 {
+		t.Errorf("重试后仍有失败记录: %+v", failed)
+	}
+}
+
+func TestUpdateKeywords(t *testing.T) {
+	l, feed, fake := newTestListener(t)
+	ctx := context.Background()
+
+	// 控制命令添加的关键词立即用于过滤，并写回配置文件
+	if got, want := newController(l, "", nil).keyword([]string{"add", "节点"}), "✅ 关键词: [订阅 节点]"; got != want {
+		t.Errorf("keyword() = %q, want %q", got, want)
+	}
+	if err := feed.NewChannelMessage(ctx, faketg.ChannelMessage(testChannelID, 60, "投稿节点 https://example.com/node")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.URLs(), []string{"https://example.com/node"}; !slices.Equal(got, want) {
+		t.Errorf("提交了 %q, want %q", got, want)
+	}
+	c, err := config.Load(l.configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"订阅", "节点"}; !slices.Equal(c.Filters.Keywords, want) || !slices.Equal(l.currentConfig().Filters.Keywords, want) {
+		t.Errorf("配置文件中的关键词 = %q, 当前配置 = %q", c.Filters.Keywords, l.currentConfig().Filters.Keywords)
+	}
+
+	if _, err := l.updateKeywords(true, "节点"); err == nil {
+		t.Error("添加已存在的关键词应返回错误")
+	}
+	if _, err := l.updateKeywords(false, "节点"); err != nil {
+		t.Fatal(err)
+	}
+	if err := feed.NewChannelMessage(ctx, faketg.ChannelMessage(testChannelID, 61, "投稿节点 https://example.com/removed")); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.submitted) != 1 {
+		t.Errorf("移除关键词后仍提交了 %q", fake.URLs())
+	}
+}
+
+func TestOwnMessagesSkipped(t *testing.T) {
+	l, feed, fake := newTestListener(t)
+	// 监听所有频道
+	if _, err := l.updateMonitorChannels(false, testChannelID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newForwarder("", forwardModeCopy, "", 0, nil); err == nil {
+		t.Error("没有设置转发目标时应返回错误")
+	}
+	var err error
+	if l.forwards, err = newForwarder("555", forwardModeCopy, "", 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// 转发出去的副本和自己发送的消息不再提交
+	if err := feed.NewChannelMessage(ctx, faketg.ChannelMessage(555, 1, "投稿订阅 https://example.com/forwarded")); err != nil {
+		t.Fatal(err)
+	}
+	out := faketg.ChannelMessage(777, 1, "投稿订阅 https://example.com/out")
+	out.SetOut(true)
+	if err := feed.NewChannelMessage(ctx, out); err != nil {
+		t.Fatal(err)
+	}
+	if err := feed.NewChannelMessage(ctx, faketg.ChannelMessage(777, 2, "投稿订阅 https://example.com/sub")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.URLs(), []string{"https://example.com/sub"}; !slices.Equal(got, want) {
+		t.Errorf("提交了 %q, want %q", got, want)
+	}
+}
+
+func TestControlChatConsumed(t *testing.T) {
+	l, _, _ := newTestListener(t)
+	c := newController(l, "888", nil)
+	ctx := context.Background()
+
+	// /test 的回复包含关键词和链接，不能被当作订阅提交
+	reply := faketg.ChannelMessage(888, 1, "🧪 过滤结果: 投稿订阅 https://example.com/sub")
+	if !c.Handle(ctx, reply) {
+		t.Error("控制对话中的回复应被消费")
+	}
+	reply.SetOut(true)
+	if !c.Handle(ctx, reply) {
+		t.Error("控制对话中自己发送的非命令消息应被消费")
+	}
+	if c.Handle(ctx, faketg.ChannelMessage(testChannelID, 2, "/status")) {
+		t.Error("其他对话中的消息不应被消费")
+	}
+}
+
+func TestNotifyTargetSkipped(t *testing.T) {
+	l, feed, fake := newTestListener(t)
+	// 监听所有频道
+	if _, err := l.updateMonitorChannels(false, testChannelID); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	if l.notices, err = newNotifier("666", false, "", 1); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// 失败告警不包含订阅 API 地址
+	l.notices.LinkResults("频道:1", "频道:1", []*store.LinkRecord{{URL: "https://example.com/a", Status: store.Failed,
+		Message: `Post "https://api.example.com/sub?token=x": connection refused`}})
+	alert := <-l.notices.messages
+	if strings.Contains(alert, "api.example.com") || !strings.Contains(alert, "connection refused") {
+		t.Errorf("告警内容 = %q", alert)
+	}
+
+	// 通知目标对话中的消息不再提交
+	if err := feed.NewChannelMessage(ctx, faketg.ChannelMessage(666, 1, "投稿订阅 https://example.com/alert")); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.URLs(); len(got) != 0 {
+		t.Errorf("提交了 %q", got)
+	}
+}
+
+func TestNotifyDigestByChannel(t *testing.T) {
+	n, err := newNotifier("me", false, digestHourly, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同一频道不同原始来源和发送者的消息汇总到一行
+	n.LinkResults("频道:1", "频道:1 ← 频道:2 👤 @alice", []*store.LinkRecord{{URL: "https://example.com/a", Status: store.Submitted}})
+	n.LinkResults("频道:1", "频道:1 👤 @bob", []*store.LinkRecord{{URL: "https://example.com/b", Status: store.Duplicate}})
+	want := "📊 最近 1h0m0s 订阅汇总\n频道:1: 成功 1 / 已存在 1 / 失败 0\n合计: 成功 1 / 已存在 1 / 失败 0"
+	if got := n.takeDigest(); got != want {
+		t.Errorf("takeDigest() = %q, want %q", got, want)
+	}
+}
+
+func TestTopicsFailClosed(t *testing.T) {
+	_, feed, fake := newTestListener(t)
+	// 频道解析前只允许配置中的数字话题 ID，按标题配置的话题解析成功后才允许
+	seedTopics(map[int64]config.ChannelOptions{testChannelID: {Topics: []string{"5", "公告"}}})
+	t.Cleanup(func() {
+		registry.mu.Lock()
+		delete(registry.topics, testChannelID)
+		registry.mu.Unlock()
+	})
+	ctx := context.Background()
+
+	for i, topic := range []int{5, 6, 0} {
+		msg := faketg.ChannelMessage(testChannelID, i+1, fmt.Sprintf("投稿订阅 https://example.com/%d", topic))
+		if topic != 0 {
+			msg.SetReplyTo(&tg.MessageReplyHeader{ForumTopic: true, ReplyToMsgID: topic})
+		}
+		if err := feed.NewChannelMessage(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := fake.URLs(), []string{"https://example.com/5"}; !slices.Equal(got, want) {
+		t.Errorf("提交了 %q, want %q", got, want)
+	}
+}
+
+func TestEditAlbumMessage(t *testing.T) {
+	l, feed, fake := newTestListener(t)
+	l.albums = newAlbumBuffer(10 * time.Millisecond)
+	ctx := context.Background()
+
+	for _, m := range []*tg.Message{
+		faketg.ChannelMessage(testChannelID, 60, "投稿订阅"),
+		faketg.ChannelMessage(testChannelID, 61, "https://example.com/a"),
+	} {
+		m.SetGroupedID(8)
+		if err := feed.NewChannelMessage(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var record *store.MessageRecord
+	for deadline := time.Now().Add(2 * time.Second); record == nil && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		record, _ = l.links.Get(testChannelID, 60)
+	}
+	if record == nil {
+		t.Fatal("相册没有被处理")
+	}
+
+	// 被编辑的消息本身没有关键词，按整个相册的内容过滤
+	edited := faketg.ChannelMessage(testChannelID, 61, "https://example.com/a https://example.com/b")
+	edited.SetGroupedID(8)
+	edited.SetEditDate(edited.Date + 1)
+	if err := feed.EditChannelMessage(ctx, edited); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.URLs(), []string{"https://example.com/a", "https://example.com/b"}; !slices.Equal(got, want) {
+		t.Errorf("提交了 %q, want %q", got, want)
+	}
+	record, _ = l.links.Get(testChannelID, 60)
+	if want := []string{"投稿订阅", "https://example.com/a https://example.com/b"}; !slices.Equal(record.Texts, want) {
+		t.Errorf("Texts = %q, want %q", record.Texts, want)
+	}
+}
+
+func TestUnmonitoredChannelMetrics(t *testing.T) {
+	_, feed, _ := newTestListener(t)
+	before := testutil.ToFloat64(metricMessages.WithLabelValues(otherChannelLabel))
+	if err := feed.NewChannelMessage(context.Background(), faketg.ChannelMessage(999, 1, "投稿订阅 https://example.com/a")); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(metricMessages.WithLabelValues(otherChannelLabel)); got != before+1 {
+		t.Errorf("other = %v, want %v", got, before+1)
+	}
+	if metricMessages.DeleteLabelValues("999") || metricLastUpdate.DeleteLabelValues("999") {
+		t.Error("不在监听列表中的频道有单独的指标")
+	}
+}
+
+func TestExportCommentChannelID(t *testing.T) {
+	l, feed, _ := newTestListener(t)
+	// 讨论组中的评论归属到所属频道
+	registry.mu.Lock()
+	registry.discussions[5555] = testChannelID
+	registry.mu.Unlock()
+	t.Cleanup(func() {
+		registry.mu.Lock()
+		delete(registry.discussions, 5555)
+		registry.mu.Unlock()
+	})
+	if err := feed.NewChannelMessage(context.Background(), faketg.ChannelMessage(5555, 1, "投稿订阅 https://example.com/a")); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := exportFromStore(filepath.Join(filepath.Dir(l.configPath), "links.json"), time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].ChannelID != testChannelID {
+		t.Errorf("exportFromStore() = %+v, want channel_id %d", rows, testChannelID)
+	}
+}
+
+func TestReplayDedup(t *testing.T) {
+	l, _, _ := newTestListener(t)
+	if err := l.links.Save(&store.MessageRecord{PeerID: testChannelID, MessageIDs: []int{1}, Date: int(time.Now().Unix()),
+		Links: []*store.LinkRecord{{URL: "https://example.com/a", Status: store.Submitted}}}); err != nil {
+		t.Fatal(err)
+	}
+	r := newReplayListener(l.currentConfig(), l.settings, l.links)
+	ctx := context.Background()
+
+	// 链接记录中已提交过的链接和回放中已出现过的链接视为已存在
+	for _, tt := range []struct {
+		text    string
+		outcome string
+	}{
+		{"投稿订阅 https://example.com/a https://example.com/b", store.Duplicate + "," + store.DryRun},
+		{"投稿订阅 https://example.com/b", store.Duplicate},
+	} {
+		_, _, results, verdict := r.replay(ctx, replayMessage{Msg: faketg.ChannelMessage(testChannelID, 2, tt.text)})
+		if verdict.Outcome != tt.outcome {
+			t.Errorf("replay(%q) = %s %+v, want %s", tt.text, verdict.Outcome, results, tt.outcome)
+		}
+	}
+	if got := l.links.Recent(10); len(got) != 1 {
+		t.Errorf("回放写入了链接记录: %+v", got)
+	}
+}
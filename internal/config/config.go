@@ -0,0 +1,260 @@
+// Package config 读取和修改 config.yaml
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config config.yaml 的内容
+type Config struct {
+	// 全局 dry-run：所有输出（订阅 API、转发、通知）只记录日志，不实际发送
+	DryRun bool `yaml:"dry_run"`
+
+	API struct {
+		ApiID       int    `yaml:"api_id"`
+		ApiHash     string `yaml:"api_hash"`
+		SessionFile string `yaml:"session_file"`
+		StateFile   string `yaml:"state_file"`
+		Proxy       string `yaml:"proxy"`
+		ProxyAddr   string `yaml:"proxy_addr"` // 旧配置，等价于 socks5://proxy_addr
+
+		// 多代理故障转移，配置后忽略 proxy
+		Proxies            []string `yaml:"proxies"`
+		ProxyStrategy      string   `yaml:"proxy_strategy"`
+		ProxyCheckInterval int      `yaml:"proxy_check_interval"` // 秒
+	} `yaml:"api"`
+
+	SubscriptionAPI struct {
+		Host     string `yaml:"host"`
+		ApiKey   string `yaml:"api_key"`
+		UseProxy bool   `yaml:"use_proxy"`
+
+		// 撤回链接的接口路径，消息编辑后链接被移除时调用
+		RetractPath string `yaml:"retract_path"`
+
+		DryRun bool `yaml:"dry_run"`
+	} `yaml:"subscription_api"`
+
+	Features struct {
+		FetchHistoryEnabled bool `yaml:"fetch_history_enabled"`
+		AlbumWindow         int  `yaml:"album_window"` // 相册合并等待时间（毫秒），0 使用默认值，-1 关闭
+		RetractOnEdit       bool `yaml:"retract_on_edit"`
+
+		// 下载并扫描消息中附带的小文本文件
+		ScanDocuments      bool     `yaml:"scan_documents"`
+		DocumentMaxSize    int64    `yaml:"document_max_size"` // 字节
+		DocumentExtensions []string `yaml:"document_extensions"`
+	} `yaml:"features"`
+
+	// 将匹配的消息转发到审核频道
+	Forward struct {
+		Enabled  bool   `yaml:"enabled"`
+		Target   string `yaml:"target"`   // me / @username / 频道 ID
+		Mode     string `yaml:"mode"`     // forward / copy
+		Template string `yaml:"template"` // 复制时的文本模板（text/template）
+		Rate     int    `yaml:"rate"`     // 每分钟最多发送的消息数
+		DryRun   bool   `yaml:"dry_run"`
+	} `yaml:"forward"`
+
+	// 通过当前账号发送订阅结果通知
+	Notify struct {
+		Enabled          bool   `yaml:"enabled"`
+		Target           string `yaml:"target"`            // me / @username / 频道 ID
+		LinkResults      bool   `yaml:"link_results"`      // 发送每个链接的处理结果
+		Digest           string `yaml:"digest"`            // hourly / daily
+		FailureThreshold int    `yaml:"failure_threshold"` // 连续失败多少次后告警
+		DryRun           bool   `yaml:"dry_run"`
+	} `yaml:"notify"`
+
+	// 在收藏夹或控制群组中发送命令管理运行中的程序
+	Control struct {
+		Enabled bool   `yaml:"enabled"`
+		Chat    string `yaml:"chat"` // me / 群组或频道 ID
+	} `yaml:"control"`
+
+	// 本地管理 HTTP API
+	Admin struct {
+		Enabled bool   `yaml:"enabled"`
+		Listen  string `yaml:"listen"`
+		Token   string `yaml:"token"`
+	} `yaml:"admin"`
+
+	// Prometheus 指标
+	Metrics struct {
+		Enabled bool   `yaml:"enabled"`
+		Listen  string `yaml:"listen"`
+	} `yaml:"metrics"`
+
+	// 健康检查，供 Docker/Kubernetes/systemd 判断是否需要重启
+	Health struct {
+		Enabled      bool   `yaml:"enabled"`
+		Listen       string `yaml:"listen"`
+		ReadyTimeout int    `yaml:"ready_timeout"` // 秒，未就绪超过该时间 /healthz 返回 503
+		UpdateWindow int    `yaml:"update_window"` // 秒，超过该时间没有收到更新 /healthz 返回 503，0 不检查
+	} `yaml:"health"`
+
+	// 日志级别、格式和文件轮转
+	Log LogConfig `yaml:"log"`
+
+	Store struct {
+		File          string `yaml:"file"`
+		RetentionDays int    `yaml:"retention_days"`
+	} `yaml:"store"`
+
+	// 消息归档，保存处理过的每条消息，可用 search 子命令搜索
+	Archive struct {
+		Enabled       bool   `yaml:"enabled"`
+		File          string `yaml:"file"`
+		RetentionDays int    `yaml:"retention_days"` // 0 表示永久保留
+	} `yaml:"archive"`
+
+	Reconnect struct {
+		InitialDelay int `yaml:"initial_delay"` // 秒
+		MaxDelay     int `yaml:"max_delay"`     // 秒
+		StallTimeout int `yaml:"stall_timeout"` // 秒
+	} `yaml:"reconnect"`
+
+	Monitor struct {
+		Channels          []int64 `yaml:"channels"`
+		WhitelistChannels []int64 `yaml:"whitelist_channels"`
+
+		// 转发来源过滤
+		OriginWhitelist    []int64 `yaml:"origin_whitelist"`     // 转发自这些频道的消息不经过二次内容过滤
+		IgnoreForwardsFrom []int64 `yaml:"ignore_forwards_from"` // 忽略转发自这些频道的消息
+
+		// 频道附加配置：论坛话题过滤、讨论组评论
+		ChannelOptions map[int64]ChannelOptions `yaml:"channel_options"`
+	} `yaml:"monitor"`
+
+	Filters struct {
+		Keywords      []string `yaml:"keywords"`
+		ContentFilter []string `yaml:"content_filter"`
+		LinkBlacklist []string `yaml:"link_blacklist"`
+	} `yaml:"filters"`
+}
+
+// LogConfig 日志配置
+type LogConfig struct {
+	Level      string            `yaml:"level"`       // debug / info / warn / error
+	Format     string            `yaml:"format"`      // text / json
+	File       string            `yaml:"file"`        // 日志文件，为空时只输出到控制台
+	MaxSize    int               `yaml:"max_size"`    // 单个日志文件大小上限（MB）
+	MaxBackups int               `yaml:"max_backups"` // 保留的旧日志文件数
+	MaxAge     int               `yaml:"max_age"`     // 旧日志文件保留天数
+	GotdLevel  string            `yaml:"gotd_level"`  // gotd 内部日志级别，为空时不输出
+	Components map[string]string `yaml:"components"`  // 组件 -> 日志级别
+}
+
+// ChannelOptions 单个频道的附加配置
+type ChannelOptions struct {
+	Topics            []string `yaml:"topics"`             // 只处理这些论坛话题（话题 ID 或标题）
+	IncludeDiscussion bool     `yaml:"include_discussion"` // 同时监听频道关联讨论组中的评论
+
+	// 群组发送者过滤，列表中可填用户 ID 或 @username
+	AllowSenders []string `yaml:"allow_senders"` // 只处理这些用户发送的消息
+	DenySenders  []string `yaml:"deny_senders"`  // 忽略这些用户发送的消息
+	AdminsOnly   bool     `yaml:"admins_only"`   // 只处理管理员发送的消息
+	DenyBots     bool     `yaml:"deny_bots"`     // 忽略机器人发送的消息
+
+	// Telegram API 不提供账号注册时间，用户 ID 随注册时间递增，用 ID 上限近似过滤新注册的账号
+	MaxSenderID int64 `yaml:"max_sender_id"` // 忽略用户 ID 大于该值的发送者，0 表示不限制
+
+	// 复制到转发目标时使用的文本模板，为空时使用 forward.template
+	ForwardTemplate string `yaml:"forward_template"`
+}
+
+// Load 读取并解析配置文件
+func Load(filename string) (Config, error) {
+	var c Config
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return c, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("解析配置文件失败: %w", err)
+	}
+
+	return c, nil
+}
+
+// SaveValue 修改配置文件中 path 指定的值并写回，尽量保留其余内容和注释
+// 写回的文件保留原文件的权限，其中包含 api_hash、api_key 等敏感信息
+func SaveValue(filename string, path []string, value any) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	crlf := bytes.Contains(data, []byte("\r\n"))
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return err
+	}
+	if len(root.Content) == 0 {
+		return fmt.Errorf("配置文件为空")
+	}
+
+	node := root.Content[0]
+	for i, key := range path {
+		if node.Kind != yaml.MappingNode {
+			return fmt.Errorf("配置项 %s 不是映射", strings.Join(path[:i], "."))
+		}
+		var next *yaml.Node
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			if node.Content[j].Value == key {
+				next = node.Content[j+1]
+				break
+			}
+		}
+		if next == nil {
+			next = &yaml.Node{Kind: yaml.MappingNode}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, next)
+		}
+		node = next
+	}
+
+	var encoded yaml.Node
+	if err := encoded.Encode(value); err != nil {
+		return err
+	}
+	// 保留原有的注释
+	encoded.HeadComment, encoded.LineComment, encoded.FootComment = node.HeadComment, node.LineComment, node.FootComment
+	*node = encoded
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&root); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+
+	out := buf.Bytes()
+	if crlf {
+		out = bytes.ReplaceAll(out, []byte("\n"), []byte("\r\n"))
+	}
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, out, 0600); err != nil {
+		return err
+	}
+	// 临时文件已存在时 WriteFile 不会修改权限，这里显式设置
+	if err := os.Chmod(tmp, info.Mode().Perm()); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
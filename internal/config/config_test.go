@@ -0,0 +1,129 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testConfig = `# Telegram API 配置
+api:
+  api_id: 12345
+  api_hash: "secret"
+
+monitor:
+  channels:
+    - 100
+
+filters:
+  # 关键词
+  keywords:
+    - 订阅 # 行尾注释
+`
+
+func writeTestConfig(t *testing.T, content string, perm os.FileMode) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), perm); err != nil {
+		t.Fatal(err)
+	}
+	// 不受 umask 影响
+	if err := os.Chmod(path, perm); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSaveValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		path  []string
+		value any
+		check func(t *testing.T, c Config)
+	}{
+		{
+			name:  "替换列表",
+			path:  []string{"filters", "keywords"},
+			value: []string{"订阅", "节点"},
+			check: func(t *testing.T, c Config) {
+				if !slices.Equal(c.Filters.Keywords, []string{"订阅", "节点"}) {
+					t.Errorf("Keywords = %q", c.Filters.Keywords)
+				}
+			},
+		},
+		{
+			name:  "嵌套的键",
+			path:  []string{"monitor", "channels"},
+			value: []int64{100, 200},
+			check: func(t *testing.T, c Config) {
+				if !slices.Equal(c.Monitor.Channels, []int64{100, 200}) {
+					t.Errorf("Monitor.Channels = %v", c.Monitor.Channels)
+				}
+			},
+		},
+		{
+			name:  "不存在的键",
+			path:  []string{"filters", "content_filter"},
+			value: []string{"投稿"},
+			check: func(t *testing.T, c Config) {
+				if !slices.Equal(c.Filters.ContentFilter, []string{"投稿"}) {
+					t.Errorf("ContentFilter = %q", c.Filters.ContentFilter)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestConfig(t, testConfig, 0600)
+			if err := SaveValue(path, tt.path, tt.value); err != nil {
+				t.Fatal(err)
+			}
+			c, err := Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, c)
+			if c.API.ApiHash != "secret" {
+				t.Errorf("其他配置被修改: APIHash = %q", c.API.ApiHash)
+			}
+
+			data, _ := os.ReadFile(path)
+			if !strings.Contains(string(data), "# Telegram API 配置") {
+				t.Errorf("注释丢失:\n%s", data)
+			}
+		})
+	}
+}
+
+func TestSaveValueKeepsFormat(t *testing.T) {
+	for _, perm := range []os.FileMode{0600, 0640} {
+		path := writeTestConfig(t, strings.ReplaceAll(testConfig, "\n", "\r\n"), perm)
+		// 上次写入残留的临时文件
+		if err := os.WriteFile(path+".tmp", nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := SaveValue(path, []string{"filters", "keywords"}, []string{"节点"}); err != nil {
+			t.Fatal(err)
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != perm {
+			t.Errorf("权限 = %v, want %v", info.Mode().Perm(), perm)
+		}
+		data, _ := os.ReadFile(path)
+		if strings.Count(string(data), "\n") != strings.Count(string(data), "\r\n") {
+			t.Errorf("换行符不是 CRLF:\n%q", data)
+		}
+	}
+}
+
+func TestSaveValueMissingFile(t *testing.T) {
+	if err := SaveValue(filepath.Join(t.TempDir(), "config.yaml"), []string{"keywords"}, []string{}); err == nil {
+		t.Error("配置文件不存在时应返回错误")
+	}
+}
@@ -0,0 +1,116 @@
+// Package extractor 从消息文本中提取订阅链接
+package extractor
+
+import (
+	"net/url"
+	"strings"
+)
+
+// FindLinks 从文本中提取所有 http/https 链接
+func FindLinks(text string) []string {
+	var links []string
+	lines := strings.Split(text, "\n")
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		// 查找包含 http:// 或 https:// 的行
+		if strings.Contains(line, "http://") || strings.Contains(line, "https://") {
+			// 循环提取当前行中的所有链接
+			remainingLine := line
+			for len(remainingLine) > 0 {
+				// 查找 http:// 或 https:// 的位置
+				httpIdx := strings.Index(remainingLine, "http://")
+				httpsIdx := strings.Index(remainingLine, "https://")
+
+				startIdx := -1
+				if httpIdx >= 0 && httpsIdx >= 0 {
+					startIdx = min(httpIdx, httpsIdx)
+				} else if httpIdx >= 0 {
+					startIdx = httpIdx
+				} else if httpsIdx >= 0 {
+					startIdx = httpsIdx
+				}
+
+				// 如果没有找到链接，退出循环
+				if startIdx < 0 {
+					break
+				}
+
+				// 从 http/https 开始提取，直到遇到空格、换行或其他分隔符
+				linkStart := startIdx
+				linkEnd := linkStart
+				for linkEnd < len(remainingLine) {
+					ch := remainingLine[linkEnd]
+					// 遇到空格、换行、中文符号等结束
+					if ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' {
+						break
+					}
+					linkEnd++
+				}
+
+				link := remainingLine[linkStart:linkEnd]
+				// 清理可能的尾部标点符号（包括中文和英文标点）
+				link = strings.TrimRight(link, ",.;!?，。；！？、")
+
+				if len(link) > 8 { // 至少要有 https:// 的长度
+					links = append(links, link)
+				}
+
+				// 继续处理剩余部分
+				remainingLine = remainingLine[linkEnd:]
+			}
+		}
+	}
+	return links
+}
+
+// Unique 去除重复项，保持原有顺序
+func Unique(items []string) []string {
+	seen := make(map[string]bool, len(items))
+	result := items[:0]
+	for _, item := range items {
+		if !seen[item] {
+			seen[item] = true
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// Host 返回链接的域名（小写）
+func Host(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// Blacklist 链接黑名单关键字，链接包含任意关键字（不区分大小写）时不提交
+type Blacklist []string
+
+// Match 返回链接命中的第一个黑名单关键字
+func (b Blacklist) Match(link string) (string, bool) {
+	linkLower := strings.ToLower(link)
+	for _, blackword := range b {
+		if strings.Contains(linkLower, strings.ToLower(blackword)) {
+			return blackword, true
+		}
+	}
+	return "", false
+}
+
+// Remove 去掉包含黑名单关键字的链接
+func (b Blacklist) Remove(links []string) []string {
+	var result []string
+	for _, link := range links {
+		if _, isBlacklisted := b.Match(link); !isBlacklisted {
+			result = append(result, link)
+		}
+	}
+	return result
+}
+
+// Extract 从文本中提取所有链接，并过滤黑名单关键字
+func (b Blacklist) Extract(text string) []string {
+	return b.Remove(FindLinks(text))
+}
@@ -0,0 +1,107 @@
+package extractor
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFindLinks(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"空文本", "", nil},
+		{"没有链接", "今日更新，欢迎投稿", nil},
+		{"单个链接", "订阅 https://example.com/sub?token=abc", []string{"https://example.com/sub?token=abc"}},
+		{"http 链接", "http://example.com/a", []string{"http://example.com/a"}},
+		{"一行多个链接", "主 https://a.example.com/1 备用 http://b.example.com/2", []string{"https://a.example.com/1", "http://b.example.com/2"}},
+		{"多行", "第一行 https://a.example.com\n第二行\n  https://b.example.com  ", []string{"https://a.example.com", "https://b.example.com"}},
+		{"去掉英文标点", "链接：https://example.com/sub.", []string{"https://example.com/sub"}},
+		{"去掉中文标点", "订阅：https://example.com/sub。", []string{"https://example.com/sub"}},
+		{"制表符分隔", "https://a.example.com\thttps://b.example.com", []string{"https://a.example.com", "https://b.example.com"}},
+		{"只有协议", "https:// 和 http://", nil},
+		{"重复链接保留", "https://example.com https://example.com", []string{"https://example.com", "https://example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FindLinks(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("FindLinks(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlacklistExtract(t *testing.T) {
+	tests := []struct {
+		name      string
+		blacklist Blacklist
+		text      string
+		want      []string
+	}{
+		{"没有黑名单", nil, "https://t.me/channel https://example.com/sub", []string{"https://t.me/channel", "https://example.com/sub"}},
+		{"去掉黑名单链接", Blacklist{"t.me"}, "https://t.me/channel https://example.com/sub", []string{"https://example.com/sub"}},
+		{"不区分大小写", Blacklist{"T.ME"}, "https://t.me/Channel", nil},
+		{"多个关键字", Blacklist{"t.me", "github.com"}, "https://github.com/x https://t.me/y https://example.com", []string{"https://example.com"}},
+		{"全部命中", Blacklist{"example"}, "https://example.com/a https://example.org/b", nil},
+		{"没有链接", Blacklist{"t.me"}, "没有链接的消息", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.blacklist.Extract(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("Extract(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlacklistMatch(t *testing.T) {
+	b := Blacklist{"t.me", "Telegram"}
+	tests := []struct {
+		link string
+		word string
+		ok   bool
+	}{
+		{"https://t.me/channel", "t.me", true},
+		{"https://TELEGRAM.org", "Telegram", true},
+		{"https://example.com", "", false},
+	}
+	for _, tt := range tests {
+		word, ok := b.Match(tt.link)
+		if word != tt.word || ok != tt.ok {
+			t.Errorf("Match(%q) = %q, %v, want %q, %v", tt.link, word, ok, tt.word, tt.ok)
+		}
+	}
+}
+
+func TestUnique(t *testing.T) {
+	tests := []struct {
+		items []string
+		want  []string
+	}{
+		{nil, nil},
+		{[]string{"a"}, []string{"a"}},
+		{[]string{"a", "b", "a", "c", "b"}, []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		if got := Unique(slices.Clone(tt.items)); !slices.Equal(got, tt.want) {
+			t.Errorf("Unique(%q) = %q, want %q", tt.items, got, tt.want)
+		}
+	}
+}
+
+func TestHost(t *testing.T) {
+	tests := []struct {
+		link string
+		want string
+	}{
+		{"https://Sub.Example.com:8443/path", "sub.example.com"},
+		{"http://example.com", "example.com"},
+		{"://bad", ""},
+	}
+	for _, tt := range tests {
+		if got := Host(tt.link); got != tt.want {
+			t.Errorf("Host(%q) = %q, want %q", tt.link, got, tt.want)
+		}
+	}
+}
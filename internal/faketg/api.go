@@ -0,0 +1,140 @@
+package faketg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// API 模拟 Telegram API，实现 tg.Invoker，通过 Client 得到可以直接使用的 *tg.Client
+// 目前支持 messages.getHistory 和 channels.getChannels，其他请求返回错误
+type API struct {
+	mu       sync.Mutex
+	users    map[int64]*tg.User
+	channels map[int64]*tg.Channel
+	history  map[int64][]*tg.Message // 频道 ID -> 消息
+	requests []string
+}
+
+// NewAPI 创建没有任何频道和消息的 API
+func NewAPI() *API {
+	return &API{
+		users:    make(map[int64]*tg.User),
+		channels: make(map[int64]*tg.Channel),
+		history:  make(map[int64][]*tg.Message),
+	}
+}
+
+// Client 返回使用该 API 的客户端
+func (a *API) Client() *tg.Client {
+	return tg.NewClient(a)
+}
+
+// AddUser 添加用户，getHistory 的结果中包含所有用户
+func (a *API) AddUser(u *tg.User) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.users[u.ID] = u
+}
+
+// AddChannel 添加频道，没有设置头像时使用空头像
+func (a *API) AddChannel(c *tg.Channel) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if c.Photo == nil {
+		c.Photo = &tg.ChatPhotoEmpty{}
+	}
+	a.channels[c.ID] = c
+}
+
+// AddHistory 添加频道的历史消息
+func (a *API) AddHistory(channelID int64, messages ...*tg.Message) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.history[channelID] = append(a.history[channelID], messages...)
+}
+
+// Requests 返回收到的请求类型，如 "messages.getHistory"
+func (a *API) Requests() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.requests...)
+}
+
+// Invoke 实现 tg.Invoker，将结果编码后交给 output 解码，与真实连接的处理方式相同
+func (a *API) Invoke(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var result bin.Encoder
+	switch req := input.(type) {
+	case *tg.MessagesGetHistoryRequest:
+		a.requests = append(a.requests, "messages.getHistory")
+		r, err := a.getHistory(req)
+		if err != nil {
+			return err
+		}
+		result = r
+	case *tg.ChannelsGetChannelsRequest:
+		a.requests = append(a.requests, "channels.getChannels")
+		result = a.getChannels(req)
+	default:
+		return fmt.Errorf("faketg: 不支持的请求 %T", input)
+	}
+
+	var b bin.Buffer
+	if err := result.Encode(&b); err != nil {
+		return fmt.Errorf("faketg: 编码 %T 失败: %w", result, err)
+	}
+	return output.Decode(&b)
+}
+
+// getHistory 按 Telegram 的顺序返回最新的 Limit 条消息，最新的在前
+func (a *API) getHistory(req *tg.MessagesGetHistoryRequest) (*tg.MessagesChannelMessages, error) {
+	peer, ok := req.Peer.(*tg.InputPeerChannel)
+	if !ok {
+		return nil, tgerr.New(400, "PEER_ID_INVALID")
+	}
+	ch, ok := a.channels[peer.ChannelID]
+	if !ok {
+		return nil, tgerr.New(400, "CHANNEL_INVALID")
+	}
+
+	messages := append([]*tg.Message(nil), a.history[peer.ChannelID]...)
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].ID > messages[j].ID
+	})
+	if req.Limit > 0 && len(messages) > req.Limit {
+		messages = messages[:req.Limit]
+	}
+
+	result := &tg.MessagesChannelMessages{
+		Count: len(a.history[peer.ChannelID]),
+		Chats: []tg.ChatClass{ch},
+	}
+	for _, m := range messages {
+		result.Messages = append(result.Messages, m)
+	}
+	for _, u := range a.users {
+		result.Users = append(result.Users, u)
+	}
+	return result, nil
+}
+
+// getChannels 返回已添加的频道，不存在的频道不出现在结果中
+func (a *API) getChannels(req *tg.ChannelsGetChannelsRequest) *tg.MessagesChats {
+	result := &tg.MessagesChats{}
+	for _, input := range req.ID {
+		if c, ok := input.(*tg.InputChannel); ok {
+			if ch, ok := a.channels[c.ChannelID]; ok {
+				result.Chats = append(result.Chats, ch)
+			}
+		}
+	}
+	return result
+}
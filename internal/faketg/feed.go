@@ -0,0 +1,124 @@
+// Package faketg 进程内的 Telegram 假实现，用于不登录账号的集成测试：
+// Feed 按 Telegram 推送更新的方式把消息交给 tg.UpdateDispatcher，API 应答客户端发出的 RPC 请求
+package faketg
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+)
+
+// Feed 模拟 Telegram 推送的更新
+// 每次推送都包装为 *tg.Updates，并带上已添加的用户和频道，处理器从 tg.Entities 中读取
+type Feed struct {
+	handler telegram.UpdateHandler
+
+	mu       sync.Mutex
+	users    map[int64]*tg.User
+	channels map[int64]*tg.Channel
+	pts      map[int64]int // 频道 ID -> pts
+	seq      int
+}
+
+// NewFeed 创建推送到 handler 的更新源，handler 通常是 tg.UpdateDispatcher
+func NewFeed(handler telegram.UpdateHandler) *Feed {
+	return &Feed{
+		handler:  handler,
+		users:    make(map[int64]*tg.User),
+		channels: make(map[int64]*tg.Channel),
+		pts:      make(map[int64]int),
+	}
+}
+
+// AddUser 添加用户，之后推送的更新的 Entities 中包含该用户
+func (f *Feed) AddUser(u *tg.User) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users[u.ID] = u
+}
+
+// AddChannel 添加频道，之后推送的更新的 Entities 中包含该频道
+func (f *Feed) AddChannel(c *tg.Channel) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.channels[c.ID] = c
+}
+
+// NewChannelMessage 推送频道或超级群组中的新消息（tg.UpdateNewChannelMessage）
+func (f *Feed) NewChannelMessage(ctx context.Context, msg *tg.Message) error {
+	pts := f.nextPts(channelOf(msg), 1)
+	return f.Send(ctx, &tg.UpdateNewChannelMessage{Message: msg, Pts: pts, PtsCount: 1})
+}
+
+// EditChannelMessage 推送消息编辑（tg.UpdateEditChannelMessage），EditDate 为 0 时设为当前时间
+func (f *Feed) EditChannelMessage(ctx context.Context, msg *tg.Message) error {
+	if msg.EditDate == 0 {
+		msg.SetEditDate(int(time.Now().Unix()))
+	}
+	pts := f.nextPts(channelOf(msg), 1)
+	return f.Send(ctx, &tg.UpdateEditChannelMessage{Message: msg, Pts: pts, PtsCount: 1})
+}
+
+// DeleteChannelMessages 推送频道消息删除（tg.UpdateDeleteChannelMessages）
+func (f *Feed) DeleteChannelMessages(ctx context.Context, channelID int64, ids ...int) error {
+	pts := f.nextPts(channelID, len(ids))
+	return f.Send(ctx, &tg.UpdateDeleteChannelMessages{ChannelID: channelID, Messages: ids, Pts: pts, PtsCount: len(ids)})
+}
+
+// Send 将更新包装为 *tg.Updates 推送给 handler
+func (f *Feed) Send(ctx context.Context, updates ...tg.UpdateClass) error {
+	f.mu.Lock()
+	f.seq++
+	u := &tg.Updates{
+		Updates: updates,
+		Date:    int(time.Now().Unix()),
+		Seq:     f.seq,
+	}
+	for _, user := range f.users {
+		u.Users = append(u.Users, user)
+	}
+	for _, ch := range f.channels {
+		u.Chats = append(u.Chats, ch)
+	}
+	f.mu.Unlock()
+
+	return f.handler.Handle(ctx, u)
+}
+
+// nextPts 按更新数推进频道的 pts
+func (f *Feed) nextPts(channelID int64, count int) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pts[channelID] += count
+	return f.pts[channelID]
+}
+
+// ChannelMessage 创建频道中的消息，Date 为当前时间
+func ChannelMessage(channelID int64, id int, text string) *tg.Message {
+	return &tg.Message{
+		ID:      id,
+		PeerID:  &tg.PeerChannel{ChannelID: channelID},
+		Date:    int(time.Now().Unix()),
+		Message: text,
+		Post:    true,
+	}
+}
+
+// UserMessage 创建超级群组中由用户发送的消息
+func UserMessage(channelID int64, id int, userID int64, text string) *tg.Message {
+	msg := ChannelMessage(channelID, id, text)
+	msg.Post = false
+	msg.SetFromID(&tg.PeerUser{UserID: userID})
+	return msg
+}
+
+// channelOf 返回消息所在的频道 ID
+func channelOf(msg *tg.Message) int64 {
+	if peer, ok := msg.PeerID.(*tg.PeerChannel); ok {
+		return peer.ChannelID
+	}
+	return 0
+}
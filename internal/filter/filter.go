@@ -0,0 +1,211 @@
+// Package filter 消息内容的过滤链：关键词匹配、二次过滤、链接提取和链接黑名单
+package filter
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"simple-listener/internal/extractor"
+	"simple-listener/internal/sink"
+)
+
+// 过滤结果
+const (
+	Skipped         = "skipped"          // 不在监听范围内（频道、话题、发送者、忽略的转发）
+	NoKeyword       = "no_keyword"       // 没有匹配关键词
+	ContentFiltered = "content_filtered" // 没有通过二次过滤
+	NoLinks         = "no_links"         // 没有链接
+	Blacklisted     = "blacklisted"      // 链接都在黑名单中
+	Matched         = "matched"          // 有需要提交的链接
+)
+
+// Step 过滤链中的一步判断
+type Step struct {
+	Step   string `json:"step"` // source / self / ignore_forwards / channel / topic / sender / keyword / content_filter / links / blacklist
+	Pass   bool   `json:"pass"`
+	Detail string `json:"detail"`
+}
+
+// String 返回 "✓ keyword: 匹配关键词 ..." 形式的文本
+func (s Step) String() string {
+	mark := "✓"
+	if !s.Pass {
+		mark = "✗"
+	}
+	return mark + " " + s.Step + ": " + s.Detail
+}
+
+// Verdict 过滤链的结果
+type Verdict struct {
+	Rule    string // 命中的规则，如 "keyword:订阅 content:投稿"
+	Outcome string
+	Trace   []Step // 每一步的判断
+}
+
+// Matched 是否有需要提交的链接
+func (v Verdict) Matched() bool {
+	return v.Outcome == Matched
+}
+
+// Record 记录一步判断
+func (v *Verdict) Record(name string, pass bool, format string, args ...any) {
+	v.Trace = append(v.Trace, Step{Step: name, Pass: pass, Detail: fmt.Sprintf(format, args...)})
+}
+
+// Config 过滤规则
+type Config struct {
+	Keywords          []string            // 消息需要包含任意关键词（不区分大小写）
+	ContentFilter     []string            // 二次过滤词，消息需要包含其中之一
+	LinkBlacklist     extractor.Blacklist // 包含这些关键字的链接不提交
+	WhitelistChannels []int64             // 这些频道的消息不经过二次过滤
+	OriginWhitelist   []int64             // 转发自这些频道的消息不经过二次过滤
+}
+
+// Message 需要过滤的消息内容
+type Message struct {
+	Text            string
+	ChannelID       int64
+	OriginChannelID int64  // 转发消息的原始频道，不是转发或来源不是频道时为 0
+	Source          string // 消息来源，提交链接时一起发送
+	Origin          string // 转发消息的原始来源
+}
+
+// MatchKeyword 返回消息中匹配的第一个关键词（不区分大小写）
+func (c Config) MatchKeyword(text string) (string, bool) {
+	for _, keyword := range c.Keywords {
+		if strings.Contains(strings.ToLower(text), strings.ToLower(keyword)) {
+			return keyword, true
+		}
+	}
+	return "", false
+}
+
+// MatchContent 返回消息中包含的第一个二次过滤词
+func (c Config) MatchContent(text string) (string, bool) {
+	for _, filterWord := range c.ContentFilter {
+		if strings.Contains(text, filterWord) {
+			return filterWord, true
+		}
+	}
+	return "", false
+}
+
+// Whitelisted 返回消息跳过二次过滤的原因（所在频道或转发的原始频道在白名单中），不在白名单中时返回空字符串
+func (c Config) Whitelisted(m Message) string {
+	if slices.Contains(c.WhitelistChannels, m.ChannelID) {
+		return fmt.Sprintf("频道 %d 在白名单中", m.ChannelID)
+	}
+	if m.OriginChannelID != 0 && slices.Contains(c.OriginWhitelist, m.OriginChannelID) {
+		return fmt.Sprintf("转发来源 %d 在白名单中", m.OriginChannelID)
+	}
+	return ""
+}
+
+// Apply 对消息内容执行关键词匹配、二次过滤和链接黑名单检查，结果记录到 v
+// 返回消息中的所有链接和通过黑名单检查的链接
+func (c Config) Apply(v *Verdict, m Message) (found, links []string) {
+	// ✅ 启用关键词匹配功能，没有匹配关键词直接跳过
+	keyword, ok := c.MatchKeyword(m.Text)
+	if !ok {
+		v.Record("keyword", false, "没有匹配任何关键词（共 %d 个）", len(c.Keywords))
+		v.Outcome = NoKeyword
+		return nil, nil
+	}
+	v.Record("keyword", true, "匹配关键词 %q", keyword)
+	v.Rule = "keyword:" + keyword
+
+	// 如果不在白名单中,需要进行二次过滤
+	// 消息内容二次过滤 - 检查是否包含“投稿”或“订阅”，不包含则直接跳过
+	if whitelist := c.Whitelisted(m); whitelist != "" {
+		v.Record("content_filter", true, "%s，跳过二次过滤", whitelist)
+		v.Rule += " whitelist"
+	} else {
+		word, ok := c.MatchContent(m.Text)
+		if !ok {
+			v.Record("content_filter", false, "不包含任何二次过滤词 %q", c.ContentFilter)
+			v.Outcome = ContentFiltered
+			return nil, nil
+		}
+		v.Record("content_filter", true, "包含 %q", word)
+		v.Rule += " content:" + word
+	}
+
+	// 提取消息中的链接，网页预览和正文中的同一链接只提交一次
+	found = extractor.Unique(extractor.FindLinks(m.Text))
+	if len(found) == 0 {
+		v.Record("links", false, "没有找到链接")
+		v.Outcome = NoLinks
+		return nil, nil
+	}
+	v.Record("links", true, "找到 %d 个链接", len(found))
+
+	for _, link := range found {
+		if word, ok := c.LinkBlacklist.Match(link); ok {
+			v.Record("blacklist", false, "%s 命中黑名单 %q", link, word)
+			continue
+		}
+		links = append(links, link)
+	}
+	if len(links) == 0 {
+		v.Outcome = Blacklisted
+		return found, nil
+	}
+	v.Record("blacklist", true, "%d 个链接没有命中黑名单", len(links))
+	v.Outcome = Matched
+	return found, links
+}
+
+// Pipeline 过滤规则和通过过滤的链接的去向
+// 规则可以在运行中被修改（如控制命令添加关键词），每次过滤使用当前的规则
+type Pipeline struct {
+	mu     sync.RWMutex
+	config Config
+	sink   sink.Sink
+}
+
+// NewPipeline 按过滤规则创建过滤链，通过过滤的链接提交到 s
+func NewPipeline(c Config, s sink.Sink) *Pipeline {
+	return &Pipeline{config: c, sink: s}
+}
+
+// Config 返回当前的过滤规则
+func (p *Pipeline) Config() Config {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.config
+}
+
+// Update 修改过滤规则，fn 返回错误时不修改
+// fn 在锁内执行，修改切片时需要复制，不能修改 Config 返回的规则中的切片
+func (p *Pipeline) Update(fn func(c *Config) error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c := p.config
+	if err := fn(&c); err != nil {
+		return err
+	}
+	p.config = c
+	return nil
+}
+
+// Sink 返回通过过滤的链接的去向
+func (p *Pipeline) Sink() sink.Sink {
+	return p.sink
+}
+
+// Filter 按当前的规则过滤消息，见 Config.Apply
+func (p *Pipeline) Filter(v *Verdict, m Message) (found, links []string) {
+	return p.Config().Apply(v, m)
+}
+
+// Submit 将链接逐个提交到 Sink，返回每个链接的处理结果
+func (p *Pipeline) Submit(ctx context.Context, m Message, links []string) []sink.Result {
+	results := make([]sink.Result, 0, len(links))
+	for _, link := range links {
+		results = append(results, p.sink.Submit(ctx, sink.Link{URL: link, Source: m.Source, Origin: m.Origin}))
+	}
+	return results
+}
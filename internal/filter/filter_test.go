@@ -0,0 +1,209 @@
+package filter
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"simple-listener/internal/extractor"
+	"simple-listener/internal/sink"
+	"simple-listener/internal/store"
+)
+
+func TestConfigApply(t *testing.T) {
+	cfg := Config{
+		Keywords:          []string{"订阅", "Clash"},
+		ContentFilter:     []string{"投稿", "分享"},
+		LinkBlacklist:     extractor.Blacklist{"t.me"},
+		WhitelistChannels: []int64{100},
+		OriginWhitelist:   []int64{200},
+	}
+	tests := []struct {
+		name    string
+		msg     Message
+		outcome string
+		rule    string
+		found   []string
+		links   []string
+	}{
+		{
+			name:    "没有关键词",
+			msg:     Message{Text: "今天天气不错 https://example.com", ChannelID: 1},
+			outcome: NoKeyword,
+		},
+		{
+			name:    "关键词不区分大小写",
+			msg:     Message{Text: "clash 订阅分享 https://example.com/sub", ChannelID: 1},
+			outcome: Matched,
+			rule:    "keyword:订阅 content:分享",
+			found:   []string{"https://example.com/sub"},
+			links:   []string{"https://example.com/sub"},
+		},
+		{
+			name:    "没有通过二次过滤",
+			msg:     Message{Text: "订阅 https://example.com/sub", ChannelID: 1},
+			outcome: ContentFiltered,
+		},
+		{
+			name:    "白名单频道跳过二次过滤",
+			msg:     Message{Text: "订阅 https://example.com/sub", ChannelID: 100},
+			outcome: Matched,
+			rule:    "keyword:订阅 whitelist",
+			found:   []string{"https://example.com/sub"},
+			links:   []string{"https://example.com/sub"},
+		},
+		{
+			name:    "转发来源在白名单中",
+			msg:     Message{Text: "订阅 https://example.com/sub", ChannelID: 1, OriginChannelID: 200},
+			outcome: Matched,
+			rule:    "keyword:订阅 whitelist",
+			found:   []string{"https://example.com/sub"},
+			links:   []string{"https://example.com/sub"},
+		},
+		{
+			name:    "转发来源不在白名单中",
+			msg:     Message{Text: "订阅 https://example.com/sub", ChannelID: 1, OriginChannelID: 300},
+			outcome: ContentFiltered,
+		},
+		{
+			name:    "二次过滤区分大小写",
+			msg:     Message{Text: "Clash 订阅 https://example.com/sub", ChannelID: 1},
+			outcome: ContentFiltered,
+		},
+		{
+			name:    "没有链接",
+			msg:     Message{Text: "投稿订阅，明天更新", ChannelID: 1},
+			outcome: NoLinks,
+			rule:    "keyword:订阅 content:投稿",
+		},
+		{
+			name:    "链接都在黑名单中",
+			msg:     Message{Text: "投稿订阅 https://t.me/a https://T.me/b", ChannelID: 1},
+			outcome: Blacklisted,
+			rule:    "keyword:订阅 content:投稿",
+			found:   []string{"https://t.me/a", "https://T.me/b"},
+		},
+		{
+			name:    "部分链接在黑名单中，重复链接只保留一个",
+			msg:     Message{Text: "投稿订阅 https://t.me/a https://example.com/sub\nhttps://example.com/sub", ChannelID: 1},
+			outcome: Matched,
+			rule:    "keyword:订阅 content:投稿",
+			found:   []string{"https://t.me/a", "https://example.com/sub"},
+			links:   []string{"https://example.com/sub"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v Verdict
+			found, links := cfg.Apply(&v, tt.msg)
+			if v.Outcome != tt.outcome {
+				t.Errorf("Outcome = %q, want %q (trace %v)", v.Outcome, tt.outcome, v.Trace)
+			}
+			if v.Matched() != (tt.outcome == Matched) {
+				t.Errorf("Matched() = %v", v.Matched())
+			}
+			if tt.rule != "" && v.Rule != tt.rule {
+				t.Errorf("Rule = %q, want %q", v.Rule, tt.rule)
+			}
+			if !slices.Equal(found, tt.found) {
+				t.Errorf("found = %q, want %q", found, tt.found)
+			}
+			if !slices.Equal(links, tt.links) {
+				t.Errorf("links = %q, want %q", links, tt.links)
+			}
+			if len(v.Trace) == 0 || v.Trace[len(v.Trace)-1].Pass != v.Matched() {
+				t.Errorf("最后一步应与结果一致: %v", v.Trace)
+			}
+		})
+	}
+}
+
+func TestConfigWhitelisted(t *testing.T) {
+	cfg := Config{WhitelistChannels: []int64{100}, OriginWhitelist: []int64{200}}
+	tests := []struct {
+		msg  Message
+		want string
+	}{
+		{Message{ChannelID: 100}, "频道 100 在白名单中"},
+		{Message{ChannelID: 1, OriginChannelID: 200}, "转发来源 200 在白名单中"},
+		{Message{ChannelID: 200}, ""},
+		{Message{ChannelID: 1, OriginChannelID: 100}, ""},
+		{Message{ChannelID: 1}, ""},
+	}
+	for _, tt := range tests {
+		if got := cfg.Whitelisted(tt.msg); got != tt.want {
+			t.Errorf("Whitelisted(%+v) = %q, want %q", tt.msg, got, tt.want)
+		}
+	}
+}
+
+// recordingSink 记录收到的链接
+type recordingSink struct {
+	links []sink.Link
+}
+
+func (s *recordingSink) Submit(_ context.Context, link sink.Link) sink.Result {
+	s.links = append(s.links, link)
+	return sink.Result{URL: link.URL, Status: store.Submitted}
+}
+
+func TestPipeline(t *testing.T) {
+	rec := &recordingSink{}
+	p := NewPipeline(Config{Keywords: []string{"订阅"}, ContentFilter: []string{"投稿"}, LinkBlacklist: extractor.Blacklist{"t.me"}}, rec)
+	msg := Message{
+		Text:   "投稿订阅 https://example.com/a https://t.me/x https://example.com/b",
+		Source: "频道 1",
+		Origin: "频道 2",
+	}
+
+	var v Verdict
+	_, links := p.Filter(&v, msg)
+	results := p.Submit(context.Background(), msg, links)
+
+	want := []sink.Link{
+		{URL: "https://example.com/a", Source: "频道 1", Origin: "频道 2"},
+		{URL: "https://example.com/b", Source: "频道 1", Origin: "频道 2"},
+	}
+	if !slices.Equal(rec.links, want) {
+		t.Errorf("Sink 收到 %+v, want %+v", rec.links, want)
+	}
+	if len(results) != len(want) {
+		t.Fatalf("results = %+v", results)
+	}
+	for i, r := range results {
+		if r.URL != want[i].URL || r.Status != store.Submitted {
+			t.Errorf("results[%d] = %+v", i, r)
+		}
+	}
+}
+
+func TestPipelineUpdate(t *testing.T) {
+	p := NewPipeline(Config{Keywords: []string{"订阅"}}, &recordingSink{})
+	before := p.Config()
+
+	// 返回错误时不修改规则
+	err := p.Update(func(c *Config) error {
+		c.Keywords = []string{"节点"}
+		return errors.New("关键词已存在")
+	})
+	if err == nil || !slices.Equal(p.Config().Keywords, []string{"订阅"}) {
+		t.Errorf("Update() = %v, Keywords = %q", err, p.Config().Keywords)
+	}
+
+	if err := p.Update(func(c *Config) error {
+		c.Keywords = append(slices.Clone(c.Keywords), "节点")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var v Verdict
+	p.Filter(&v, Message{Text: "免费节点"})
+	if v.Rule != "keyword:节点" {
+		t.Errorf("修改后 Rule = %q", v.Rule)
+	}
+	// 修改前取得的规则不受影响
+	if !slices.Equal(before.Keywords, []string{"订阅"}) {
+		t.Errorf("修改前的 Keywords = %q", before.Keywords)
+	}
+}
@@ -0,0 +1,185 @@
+// Package sink 通过过滤的链接的去向，目前为订阅管理系统的 HTTP API
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"simple-listener/internal/store"
+)
+
+// Link 需要提交的链接
+type Link struct {
+	URL    string
+	Source string // 消息来源
+	Origin string // 转发消息的原始来源
+}
+
+// Result 单个链接的处理结果
+type Result struct {
+	URL     string
+	Status  string // store.Submitted / store.Duplicate / store.Failed / store.DryRun
+	Message string
+}
+
+// Sink 接收通过过滤的链接
+type Sink interface {
+	Submit(ctx context.Context, link Link) Result
+}
+
+// Retractor 可以撤回已提交链接的 Sink，消息编辑后链接被移除时调用
+type Retractor interface {
+	Retract(ctx context.Context, url string) (bool, string)
+}
+
+// dryRunMessage dry-run 模式下订阅 API 的返回信息
+const dryRunMessage = "[dry-run] 请求未发送"
+
+// SubscriptionAPI 订阅管理系统的 HTTP API
+type SubscriptionAPI struct {
+	Host        string
+	APIKey      string
+	RetractPath string       // 撤回链接的接口路径
+	Client      *http.Client // 为 nil 时使用 http.DefaultClient
+
+	// dry-run 模式下不发送请求，按 Seen 去重后返回 store.DryRun
+	DryRun bool
+	Seen   func(url string) bool // 链接是否已经提交过，可以为 nil
+
+	// 以下回调可以为 nil
+	OnDryRun func(method, url string, body []byte)    // dry-run 模式下本应发送的请求
+	Observe  func(path string, elapsed time.Duration) // 每次请求的耗时
+}
+
+// Submit 提交单个链接
+// dry-run 模式下先检查链接格式，并通过 Seen 去重，再记录本应发送的请求
+func (a *SubscriptionAPI) Submit(ctx context.Context, link Link) Result {
+	if a.DryRun {
+		if u, err := url.Parse(link.URL); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return Result{URL: link.URL, Status: store.Failed, Message: "[dry-run] 无效链接"}
+		}
+		if a.Seen != nil && a.Seen(link.URL) {
+			return Result{URL: link.URL, Status: store.Duplicate, Message: "[dry-run] 链接记录中已存在"}
+		}
+	}
+
+	success, message := a.Add(ctx, link.URL, link.Source, link.Origin)
+	r := Result{URL: link.URL, Message: message}
+	switch {
+	case a.DryRun:
+		r.Status = store.DryRun
+	case success:
+		r.Status = store.Submitted
+	case message == "订阅已存在":
+		r.Status = store.Duplicate
+	default:
+		r.Status = store.Failed
+	}
+	return r
+}
+
+// Add 添加订阅链接到订阅管理系统
+// 参数: subURL - 订阅链接, source - 消息来源, origin - 转发消息的原始来源
+// 返回: (成功, 消息)
+func (a *SubscriptionAPI) Add(ctx context.Context, subURL, source, origin string) (bool, string) {
+	requestBody := map[string]string{
+		"sub_url": subURL,
+	}
+	if source != "" {
+		requestBody["source"] = source
+	}
+	if origin != "" {
+		requestBody["origin"] = origin
+	}
+	return a.call(ctx, "/api/config/add", requestBody)
+}
+
+// Retract 通知订阅管理系统撤回订阅链接
+// 参数: subURL - 订阅链接
+// 返回: (成功, 消息)
+func (a *SubscriptionAPI) Retract(ctx context.Context, subURL string) (bool, string) {
+	return a.call(ctx, a.RetractPath, map[string]string{
+		"sub_url": subURL,
+	})
+}
+
+// call 以 JSON 请求体调用订阅 API
+func (a *SubscriptionAPI) call(ctx context.Context, path string, requestBody map[string]string) (bool, string) {
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return false, fmt.Sprintf("JSON 编码失败: %v", err)
+	}
+
+	// 构建请求
+	apiURL := fmt.Sprintf("http://%s%s", a.Host, path)
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return false, fmt.Sprintf("创建请求失败: %v", err)
+	}
+
+	// 设置请求头
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", a.APIKey)
+
+	// dry-run 只记录请求，不发送
+	if a.DryRun {
+		if a.OnDryRun != nil {
+			a.OnDryRun(req.Method, apiURL, jsonData)
+		}
+		return true, dryRunMessage
+	}
+
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	// 发送请求
+	start := time.Now()
+	resp, err := client.Do(req)
+	if a.Observe != nil {
+		a.Observe(path, time.Since(start))
+	}
+	if err != nil {
+		return false, fmt.Sprintf("API 请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// 读取响应
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, fmt.Sprintf("读取响应失败: %v", err)
+	}
+
+	// 检查状态码
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Sprintf("API 返回错误状态码 %d: %s", resp.StatusCode, string(body))
+	}
+
+	// 解析响应
+	var result struct {
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}
+
+	if err := json.Unmarshal(body, &result); err != nil {
+		return false, fmt.Sprintf("解析响应失败: %v", err)
+	}
+
+	// 检查是否是重复订阅
+	if result.Error != "" {
+		if strings.Contains(result.Error, "已存在") || strings.Contains(strings.ToLower(result.Error), "already exists") {
+			return false, "订阅已存在"
+		}
+		return false, result.Error
+	}
+
+	return true, result.Message
+}
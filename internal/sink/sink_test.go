@@ -0,0 +1,134 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"simple-listener/internal/store"
+)
+
+// newTestAPI 启动返回固定响应的订阅 API，收到的请求体保存到 requests
+func newTestAPI(t *testing.T, status int, response string, requests *[]map[string]string) *SubscriptionAPI {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/config/add" {
+			t.Errorf("请求 %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("X-API-Key"); got != "secret" {
+			t.Errorf("X-API-Key = %q", got)
+		}
+		if got := r.Header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("Content-Type = %q", got)
+		}
+		body, _ := io.ReadAll(r.Body)
+		var req map[string]string
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("请求体不是 JSON: %s", body)
+		}
+		if requests != nil {
+			*requests = append(*requests, req)
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, response)
+	}))
+	t.Cleanup(srv.Close)
+	return &SubscriptionAPI{
+		Host:   strings.TrimPrefix(srv.URL, "http://"),
+		APIKey: "secret",
+		Client: srv.Client(),
+	}
+}
+
+func TestSubscriptionAPIAdd(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		response    string
+		wantOK      bool
+		wantMessage string
+	}{
+		{"添加成功", http.StatusOK, `{"message":"添加成功"}`, true, "添加成功"},
+		{"订阅已存在", http.StatusOK, `{"error":"订阅已存在: https://example.com/sub"}`, false, "订阅已存在"},
+		{"already exists", http.StatusOK, `{"error":"Subscription Already Exists"}`, false, "订阅已存在"},
+		{"其他错误", http.StatusOK, `{"error":"无效的订阅"}`, false, "无效的订阅"},
+		{"错误状态码", http.StatusUnauthorized, `unauthorized`, false, "API 返回错误状态码 401: unauthorized"},
+		{"响应不是 JSON", http.StatusOK, `ok`, false, "解析响应失败"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []map[string]string
+			api := newTestAPI(t, tt.status, tt.response, &requests)
+
+			ok, message := api.Add(context.Background(), "https://example.com/sub", "示例频道", "")
+			if ok != tt.wantOK || !strings.HasPrefix(message, tt.wantMessage) {
+				t.Errorf("Add() = %v, %q, want %v, %q", ok, message, tt.wantOK, tt.wantMessage)
+			}
+			if len(requests) != 1 {
+				t.Fatalf("收到 %d 个请求", len(requests))
+			}
+			if requests[0]["sub_url"] != "https://example.com/sub" || requests[0]["source"] != "示例频道" {
+				t.Errorf("请求体 = %v", requests[0])
+			}
+			if _, ok := requests[0]["origin"]; ok {
+				t.Errorf("origin 为空时不应发送: %v", requests[0])
+			}
+		})
+	}
+}
+
+func TestSubscriptionAPIAddUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	api := &SubscriptionAPI{Host: strings.TrimPrefix(srv.URL, "http://")}
+	if ok, message := api.Add(context.Background(), "https://example.com/sub", "", ""); ok || !strings.HasPrefix(message, "API 请求失败") {
+		t.Errorf("Add() = %v, %q", ok, message)
+	}
+}
+
+func TestSubscriptionAPISubmit(t *testing.T) {
+	tests := []struct {
+		name       string
+		response   string
+		dryRun     bool
+		seen       bool
+		link       string
+		wantStatus string
+		wantCalls  int
+	}{
+		{"提交成功", `{"message":"ok"}`, false, false, "https://example.com/sub", store.Submitted, 1},
+		{"订阅已存在", `{"error":"已存在"}`, false, false, "https://example.com/sub", store.Duplicate, 1},
+		{"提交失败", `{"error":"无效"}`, false, false, "https://example.com/sub", store.Failed, 1},
+		{"dry-run 不发送请求", `{"message":"ok"}`, true, false, "https://example.com/sub", store.DryRun, 0},
+		{"dry-run 已提交过", `{"message":"ok"}`, true, true, "https://example.com/sub", store.Duplicate, 0},
+		{"dry-run 无效链接", `{"message":"ok"}`, true, false, "ftp://example.com/sub", store.Failed, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []map[string]string
+			api := newTestAPI(t, http.StatusOK, tt.response, &requests)
+			api.DryRun = tt.dryRun
+			api.Seen = func(string) bool { return tt.seen }
+			var dryRuns int
+			api.OnDryRun = func(method, url string, body []byte) { dryRuns++ }
+
+			r := api.Submit(context.Background(), Link{URL: tt.link, Source: "示例频道", Origin: "原始频道"})
+			if r.Status != tt.wantStatus || r.URL != tt.link {
+				t.Errorf("Submit() = %+v, want status %q", r, tt.wantStatus)
+			}
+			if len(requests) != tt.wantCalls {
+				t.Errorf("收到 %d 个请求, want %d", len(requests), tt.wantCalls)
+			}
+			if tt.wantCalls > 0 && requests[0]["origin"] != "原始频道" {
+				t.Errorf("请求体 = %v", requests[0])
+			}
+			if wantDryRuns := map[bool]int{true: 1}[tt.wantStatus == store.DryRun]; dryRuns != wantDryRuns {
+				t.Errorf("OnDryRun 调用 %d 次, want %d", dryRuns, wantDryRuns)
+			}
+		})
+	}
+}
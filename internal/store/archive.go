@@ -0,0 +1,318 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	_ "modernc.org/sqlite"
+
+	"simple-listener/internal/extractor"
+)
+
+// 归档数据库结构，messages_fts 使用 trigram 分词，中文也能按子串搜索
+const archiveSchema = `
+CREATE TABLE IF NOT EXISTS messages (
+	id          INTEGER PRIMARY KEY,
+	channel_id  INTEGER NOT NULL,
+	peer_id     INTEGER NOT NULL,
+	message_id  INTEGER NOT NULL,
+	message_ids TEXT    NOT NULL,
+	date        INTEGER NOT NULL,
+	edit_date   INTEGER NOT NULL DEFAULT 0,
+	source      TEXT    NOT NULL,
+	text        TEXT    NOT NULL,
+	rule        TEXT    NOT NULL,
+	outcome     TEXT    NOT NULL,
+	deleted     INTEGER NOT NULL DEFAULT 0,
+	UNIQUE (peer_id, message_id)
+);
+CREATE INDEX IF NOT EXISTS messages_channel_date ON messages (channel_id, date);
+CREATE INDEX IF NOT EXISTS messages_date ON messages (date);
+
+CREATE TABLE IF NOT EXISTS links (
+	message_rowid INTEGER NOT NULL REFERENCES messages (id) ON DELETE CASCADE,
+	url           TEXT    NOT NULL,
+	host          TEXT    NOT NULL,
+	status        TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS links_message ON links (message_rowid);
+CREATE INDEX IF NOT EXISTS links_host ON links (host);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5 (
+	text, content = 'messages', content_rowid = 'id', tokenize = 'trigram'
+);
+CREATE TRIGGER IF NOT EXISTS messages_ai AFTER INSERT ON messages BEGIN
+	INSERT INTO messages_fts (rowid, text) VALUES (new.id, new.text);
+END;
+CREATE TRIGGER IF NOT EXISTS messages_ad AFTER DELETE ON messages BEGIN
+	INSERT INTO messages_fts (messages_fts, rowid, text) VALUES ('delete', old.id, old.text);
+END;
+CREATE TRIGGER IF NOT EXISTS messages_au AFTER UPDATE OF text ON messages BEGIN
+	INSERT INTO messages_fts (messages_fts, rowid, text) VALUES ('delete', old.id, old.text);
+	INSERT INTO messages_fts (rowid, text) VALUES (new.id, new.text);
+END;
+`
+
+// ArchiveEntry 一条归档消息，相册以第一条消息为准
+type ArchiveEntry struct {
+	ChannelID  int64         `json:"channel_id"`
+	PeerID     int64         `json:"peer_id"`
+	MessageIDs []int         `json:"message_ids"`
+	Date       time.Time     `json:"date"`
+	EditDate   int           `json:"edit_date,omitempty"`
+	Source     string        `json:"source"`
+	Text       string        `json:"text"`
+	Rule       string        `json:"rule,omitempty"`
+	Outcome    string        `json:"outcome"`
+	Links      []*LinkRecord `json:"links,omitempty"`
+	Deleted    bool          `json:"deleted,omitempty"`
+}
+
+// ArchiveQuery 归档搜索条件，零值表示不限制
+type ArchiveQuery struct {
+	Text    string    // 全文搜索，多个词用空格分隔，需要同时包含
+	Channel string    // 频道 ID，或来源名称的一部分
+	Since   time.Time // 包含
+	Until   time.Time // 不包含
+	Host    string    // 链接域名，包括子域名
+	Limit   int
+}
+
+// Archive 将处理过的每条消息保存到 SQLite，支持全文搜索
+type Archive struct {
+	db        *sql.DB
+	retention time.Duration
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+// OpenArchive 打开归档数据库，不存在时创建
+func OpenArchive(path string, retention time.Duration) (*Archive, error) {
+	// WAL 模式下 search 子命令可以在程序运行时读取
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("打开归档数据库失败: %w", err)
+	}
+	// SQLite 同时只能有一个写入者
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(archiveSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化归档数据库失败: %w", err)
+	}
+	return &Archive{db: db, retention: retention}, nil
+}
+
+// Close 关闭数据库
+func (a *Archive) Close() error {
+	return a.db.Close()
+}
+
+// Save 添加或更新归档消息，消息被编辑时覆盖内容和链接
+func (a *Archive) Save(e *ArchiveEntry) error {
+	if len(e.MessageIDs) == 0 {
+		return nil
+	}
+	ids := make([]string, len(e.MessageIDs))
+	for i, id := range e.MessageIDs {
+		ids[i] = strconv.Itoa(id)
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		return fmt.Errorf("归档消息失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	var rowID int64
+	err = tx.QueryRow(`
+		INSERT INTO messages (channel_id, peer_id, message_id, message_ids, date, edit_date, source, text, rule, outcome)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (peer_id, message_id) DO UPDATE SET
+			message_ids = excluded.message_ids,
+			edit_date = excluded.edit_date,
+			source = excluded.source,
+			text = excluded.text,
+			rule = excluded.rule,
+			outcome = excluded.outcome
+		RETURNING id`,
+		e.ChannelID, e.PeerID, e.MessageIDs[0], strings.Join(ids, ","), e.Date.Unix(), e.EditDate,
+		e.Source, e.Text, e.Rule, e.Outcome,
+	).Scan(&rowID)
+	if err != nil {
+		return fmt.Errorf("归档消息失败: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM links WHERE message_rowid = ?`, rowID); err != nil {
+		return fmt.Errorf("归档消息失败: %w", err)
+	}
+	for _, l := range e.Links {
+		if _, err := tx.Exec(`INSERT INTO links (message_rowid, url, host, status) VALUES (?, ?, ?, ?)`,
+			rowID, l.URL, extractor.Host(l.URL), l.Status); err != nil {
+			return fmt.Errorf("归档消息失败: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("归档消息失败: %w", err)
+	}
+
+	if err := a.prune(); err != nil {
+		return fmt.Errorf("清理归档消息失败: %w", err)
+	}
+	return nil
+}
+
+// MarkDeleted 标记频道中被删除的消息，相册中任意一条被删除时标记整个相册
+func (a *Archive) MarkDeleted(peerID int64, messageIDs []int) error {
+	for _, id := range messageIDs {
+		_, err := a.db.Exec(`
+			UPDATE messages SET deleted = 1
+			WHERE peer_id = ? AND (message_id = ? OR ',' || message_ids || ',' LIKE ?)`,
+			peerID, id, "%,"+strconv.Itoa(id)+",%")
+		if err != nil {
+			return fmt.Errorf("标记归档消息删除失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// Search 按条件搜索归档消息，最新的在前
+func (a *Archive) Search(q ArchiveQuery) ([]*ArchiveEntry, error) {
+	var (
+		where []string
+		args  []any
+	)
+	for _, term := range strings.Fields(q.Text) {
+		if utf8.RuneCountInString(term) >= 3 {
+			// trigram 索引只能匹配至少 3 个字符的词
+			where = append(where, `m.id IN (SELECT rowid FROM messages_fts WHERE messages_fts MATCH ?)`)
+			args = append(args, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+		} else {
+			where = append(where, `m.id IN (SELECT rowid FROM messages_fts WHERE text LIKE ? ESCAPE '\')`)
+			args = append(args, "%"+escapeLike(term)+"%")
+		}
+	}
+	if q.Channel != "" {
+		if id, err := strconv.ParseInt(q.Channel, 10, 64); err == nil {
+			where = append(where, `(m.channel_id = ? OR m.peer_id = ?)`)
+			args = append(args, id, id)
+		} else {
+			where = append(where, `m.source LIKE ? ESCAPE '\'`)
+			args = append(args, "%"+escapeLike(q.Channel)+"%")
+		}
+	}
+	if !q.Since.IsZero() {
+		where = append(where, `m.date >= ?`)
+		args = append(args, q.Since.Unix())
+	}
+	if !q.Until.IsZero() {
+		where = append(where, `m.date < ?`)
+		args = append(args, q.Until.Unix())
+	}
+	if q.Host != "" {
+		host := strings.ToLower(strings.TrimPrefix(q.Host, "."))
+		where = append(where, `m.id IN (SELECT message_rowid FROM links WHERE host = ? OR host LIKE ? ESCAPE '\')`)
+		args = append(args, host, "%."+escapeLike(host))
+	}
+
+	query := `SELECT m.id, m.channel_id, m.peer_id, m.message_ids, m.date, m.edit_date, m.source, m.text, m.rule, m.outcome, m.deleted FROM messages m`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY m.date DESC, m.id DESC"
+	if q.Limit > 0 {
+		query += " LIMIT " + strconv.Itoa(q.Limit)
+	}
+
+	rows, err := a.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("搜索归档失败: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		entries []*ArchiveEntry
+		rowIDs  []int64
+	)
+	for rows.Next() {
+		var (
+			e       ArchiveEntry
+			rowID   int64
+			ids     string
+			date    int64
+			deleted int
+		)
+		if err := rows.Scan(&rowID, &e.ChannelID, &e.PeerID, &ids, &date, &e.EditDate,
+			&e.Source, &e.Text, &e.Rule, &e.Outcome, &deleted); err != nil {
+			return nil, fmt.Errorf("搜索归档失败: %w", err)
+		}
+		for _, s := range strings.Split(ids, ",") {
+			if id, err := strconv.Atoi(s); err == nil {
+				e.MessageIDs = append(e.MessageIDs, id)
+			}
+		}
+		e.Date = time.Unix(date, 0)
+		e.Deleted = deleted != 0
+		entries = append(entries, &e)
+		rowIDs = append(rowIDs, rowID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("搜索归档失败: %w", err)
+	}
+	rows.Close()
+
+	for i, e := range entries {
+		if e.Links, err = a.links(rowIDs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// links 读取归档消息中的链接
+func (a *Archive) links(rowID int64) ([]*LinkRecord, error) {
+	rows, err := a.db.Query(`SELECT url, status FROM links WHERE message_rowid = ? ORDER BY rowid`, rowID)
+	if err != nil {
+		return nil, fmt.Errorf("读取归档链接失败: %w", err)
+	}
+	defer rows.Close()
+
+	var links []*LinkRecord
+	for rows.Next() {
+		var l LinkRecord
+		if err := rows.Scan(&l.URL, &l.Status); err != nil {
+			return nil, fmt.Errorf("读取归档链接失败: %w", err)
+		}
+		links = append(links, &l)
+	}
+	return links, rows.Err()
+}
+
+// prune 每小时最多一次删除超过保留时间的消息
+func (a *Archive) prune() error {
+	if a.retention <= 0 {
+		return nil
+	}
+	a.mu.Lock()
+	if time.Since(a.lastPrune) < time.Hour {
+		a.mu.Unlock()
+		return nil
+	}
+	a.lastPrune = time.Now()
+	a.mu.Unlock()
+
+	cutoff := time.Now().Add(-a.retention).Unix()
+	_, err := a.db.Exec(`DELETE FROM messages WHERE date < ?`, cutoff)
+	return err
+}
+
+// escapeLike 转义 LIKE 中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,161 @@
+package store
+
+import (
+	"maps"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newTestArchive 在临时目录中创建归档数据库
+func newTestArchive(t *testing.T, retention time.Duration) *Archive {
+	t.Helper()
+	a, err := OpenArchive(filepath.Join(t.TempDir(), "archive.db"), retention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+	return a
+}
+
+// messageIDs 返回搜索结果中各条消息的第一个消息 ID
+func messageIDs(entries []*ArchiveEntry) []int {
+	ids := make([]int, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.MessageIDs[0])
+	}
+	return ids
+}
+
+func TestArchiveSearch(t *testing.T) {
+	a := newTestArchive(t, 0)
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local)
+	for _, e := range []*ArchiveEntry{
+		{ChannelID: 100, PeerID: 100, MessageIDs: []int{1}, Date: base, Source: "频道:100", Text: "今日免费节点订阅", Outcome: Submitted,
+			Links: []*LinkRecord{{URL: "https://sub.example.com/a", Status: Submitted}}},
+		{ChannelID: 100, PeerID: 200, MessageIDs: []int{2}, Date: base.Add(time.Hour), Source: "频道:100/comment", Text: "评论里的 Clash 配置", Outcome: "no_keyword"},
+		{ChannelID: 300, PeerID: 300, MessageIDs: []int{3}, Date: base.Add(2 * time.Hour), Source: "群组:300", Text: "机场订阅 50% off", Outcome: Blacklisted,
+			Links: []*LinkRecord{{URL: "https://example.org/b", Status: Blacklisted}}},
+	} {
+		if err := a.Save(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query ArchiveQuery
+		want  []int
+	}{
+		{"全部，最新的在前", ArchiveQuery{}, []int{3, 2, 1}},
+		{"全文搜索", ArchiveQuery{Text: "免费节点"}, []int{1}},
+		{"少于 3 个字的词", ArchiveQuery{Text: "订阅"}, []int{3, 1}},
+		{"多个词同时包含", ArchiveQuery{Text: "机场 订阅"}, []int{3}},
+		{"LIKE 通配符按原样匹配", ArchiveQuery{Text: "0%"}, []int{3}},
+		{"频道 ID 包括讨论组", ArchiveQuery{Channel: "100"}, []int{2, 1}},
+		{"来源名称", ArchiveQuery{Channel: "comment"}, []int{2}},
+		{"时间范围", ArchiveQuery{Since: base.Add(time.Hour), Until: base.Add(2 * time.Hour)}, []int{2}},
+		{"域名包括子域名", ArchiveQuery{Host: "example.com"}, []int{1}},
+		{"域名不匹配后缀", ArchiveQuery{Host: "ample.com"}, []int{}},
+		{"数量限制", ArchiveQuery{Limit: 2}, []int{3, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := a.Search(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := messageIDs(entries); !slices.Equal(got, tt.want) {
+				t.Errorf("Search(%+v) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+
+	entries, err := a.Search(ArchiveQuery{Text: "免费节点"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := entries[0]; !e.Date.Equal(base) || e.Source != "频道:100" || len(e.Links) != 1 || e.Links[0].Status != Submitted {
+		t.Errorf("归档消息 = %+v", e)
+	}
+}
+
+func TestArchiveSaveEdited(t *testing.T) {
+	a := newTestArchive(t, 0)
+	e := &ArchiveEntry{ChannelID: 100, PeerID: 100, MessageIDs: []int{1}, Date: time.Now(), Source: "频道:100", Text: "原来的内容", Outcome: Submitted,
+		Links: []*LinkRecord{{URL: "https://example.com/a", Status: Submitted}}}
+	if err := a.Save(e); err != nil {
+		t.Fatal(err)
+	}
+
+	// 编辑后覆盖内容和链接，全文索引同时更新
+	e.EditDate = 10
+	e.Text = "编辑后的内容"
+	e.Links = []*LinkRecord{{URL: "https://example.com/a", Status: Removed}, {URL: "https://example.com/b", Status: Submitted}}
+	if err := a.Save(e); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := a.Search(ArchiveQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].EditDate != 10 || len(entries[0].Links) != 2 || entries[0].Links[0].Status != Removed {
+		t.Fatalf("Search() = %+v", entries)
+	}
+	if old, _ := a.Search(ArchiveQuery{Text: "原来的内容"}); len(old) != 0 {
+		t.Errorf("仍能搜索到编辑前的内容: %+v", old)
+	}
+	if edited, _ := a.Search(ArchiveQuery{Text: "编辑后的内容"}); len(edited) != 1 {
+		t.Errorf("搜索不到编辑后的内容: %+v", edited)
+	}
+}
+
+func TestArchiveMarkDeleted(t *testing.T) {
+	a := newTestArchive(t, 0)
+	for _, e := range []*ArchiveEntry{
+		{PeerID: 100, MessageIDs: []int{1}, Date: time.Now(), Text: "单条消息"},
+		{PeerID: 100, MessageIDs: []int{10, 11, 12}, Date: time.Now(), Text: "相册"},
+		{PeerID: 200, MessageIDs: []int{11}, Date: time.Now(), Text: "其他频道"},
+	} {
+		if err := a.Save(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 删除相册中的一条消息时标记整个相册
+	if err := a.MarkDeleted(100, []int{11}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := a.Search(ArchiveQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted := make(map[string]bool)
+	for _, e := range entries {
+		deleted[e.Text] = e.Deleted
+	}
+	if want := map[string]bool{"单条消息": false, "相册": true, "其他频道": false}; !maps.Equal(deleted, want) {
+		t.Errorf("deleted = %v, want %v", deleted, want)
+	}
+}
+
+func TestArchiveRetention(t *testing.T) {
+	a := newTestArchive(t, 24*time.Hour)
+	for _, e := range []*ArchiveEntry{
+		{PeerID: 100, MessageIDs: []int{1}, Date: time.Now().Add(-48 * time.Hour), Text: "过期的消息"},
+		{PeerID: 100, MessageIDs: []int{2}, Date: time.Now(), Text: "新消息"},
+	} {
+		if err := a.Save(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := a.Search(ArchiveQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := messageIDs(entries); !slices.Equal(got, []int{2}) {
+		t.Errorf("保留的消息 = %v, want [2]", got)
+	}
+}
@@ -0,0 +1,367 @@
+// Package store 保存提取到链接的消息记录和消息归档
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 链接处理结果
+const (
+	Submitted = "submitted" // 已提交到订阅 API
+	Duplicate = "duplicate" // 订阅已存在
+	Failed    = "failed"    // 提交失败
+	Removed   = "removed"   // 消息编辑后链接被移除
+	Retracted = "retracted" // 消息编辑后链接被移除，已撤回
+	DryRun    = "dry_run"   // dry-run 模式，未实际提交
+
+	// 以下只出现在消息归档中
+	Blacklisted = "blacklisted" // 在黑名单中，未提交
+	Ignored     = "ignored"     // 消息没有通过关键词或二次过滤，未提交
+)
+
+// LinkRecord 单个链接的处理记录
+type LinkRecord struct {
+	URL     string    `json:"url"`
+	Status  string    `json:"status"`
+	Message string    `json:"message,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// MessageRecord 提取到链接的消息记录，相册以第一条消息为准
+type MessageRecord struct {
+	PeerID     int64         `json:"peer_id"`
+	ChannelID  int64         `json:"channel_id,omitempty"` // 所属频道，讨论组评论为讨论组所属的频道，旧记录为 0
+	MessageIDs []int         `json:"message_ids"`
+	Source     string        `json:"source"`
+	Origin     string        `json:"origin,omitempty"` // 转发消息的原始来源
+	Date       int           `json:"date"`
+	EditDate   int           `json:"edit_date,omitempty"`
+	Links      []*LinkRecord `json:"links"`
+	Texts      []string      `json:"texts,omitempty"` // 相册各条消息的文本，与 MessageIDs 对应，编辑时按合并后的内容过滤
+	Deleted    bool          `json:"deleted,omitempty"`
+	DeletedAt  *time.Time    `json:"deleted_at,omitempty"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+}
+
+// ChannelStatus 监听频道的访问状态
+type ChannelStatus struct {
+	Title      string    `json:"title,omitempty"`
+	Accessible bool      `json:"accessible"`
+	Reason     string    `json:"reason,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// linkFile 链接记录文件内容
+type linkFile struct {
+	Records  []*MessageRecord         `json:"records"`
+	Channels map[int64]*ChannelStatus `json:"channels,omitempty"`
+}
+
+// HasLink 检查记录中是否已有该链接
+func (r *MessageRecord) HasLink(url string) bool {
+	for _, l := range r.Links {
+		if l.URL == url {
+			return true
+		}
+	}
+	return false
+}
+
+// clone 返回记录的深拷贝，LinkStore 对外只返回拷贝，避免在锁外修改共享的记录
+func (r *MessageRecord) clone() *MessageRecord {
+	c := *r
+	c.MessageIDs = slices.Clone(r.MessageIDs)
+	c.Texts = slices.Clone(r.Texts)
+	if r.Links != nil {
+		c.Links = make([]*LinkRecord, len(r.Links))
+		for i, l := range r.Links {
+			link := *l
+			c.Links[i] = &link
+		}
+	}
+	if r.DeletedAt != nil {
+		deletedAt := *r.DeletedAt
+		c.DeletedAt = &deletedAt
+	}
+	return &c
+}
+
+// LinkStore 保存消息与提取出的链接，用于编辑消息时比较新旧链接
+// 查询方法返回记录的拷贝，修改后通过 Save 或 Update 写回
+type LinkStore struct {
+	mu        sync.Mutex
+	path      string
+	retention time.Duration
+	records   map[string]*MessageRecord // peerID:第一条消息ID -> 记录
+	index     map[string]string         // peerID:任意消息ID -> 记录键
+	channels  map[int64]*ChannelStatus  // 频道 ID -> 访问状态
+}
+
+// NewLinkStore 打开链接记录文件，文件不存在时创建空记录
+func NewLinkStore(path string, retention time.Duration) (*LinkStore, error) {
+	s := &LinkStore{
+		path:      path,
+		retention: retention,
+		records:   make(map[string]*MessageRecord),
+		index:     make(map[string]string),
+		channels:  make(map[int64]*ChannelStatus),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("读取链接记录失败: %w", err)
+	}
+
+	var file linkFile
+	if len(data) > 0 && data[0] == '[' {
+		// 旧格式：只有消息记录数组
+		err = json.Unmarshal(data, &file.Records)
+	} else {
+		err = json.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析链接记录失败: %w", err)
+	}
+	for _, r := range file.Records {
+		s.put(r)
+	}
+	for id, status := range file.Channels {
+		s.channels[id] = status
+	}
+	return s, nil
+}
+
+func recordKey(peerID int64, messageID int) string {
+	return fmt.Sprintf("%d:%d", peerID, messageID)
+}
+
+// put 添加记录并更新索引（调用方需持有锁）
+func (s *LinkStore) put(r *MessageRecord) {
+	if len(r.MessageIDs) == 0 {
+		return
+	}
+	key := recordKey(r.PeerID, r.MessageIDs[0])
+	s.records[key] = r
+	for _, id := range r.MessageIDs {
+		s.index[recordKey(r.PeerID, id)] = key
+	}
+}
+
+// Get 按消息 ID 查找记录，相册中任意一条消息都能找到整个相册的记录
+func (s *LinkStore) Get(peerID int64, messageID int) (*MessageRecord, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.index[recordKey(peerID, messageID)]
+	if !ok {
+		return nil, false
+	}
+	r, ok := s.records[key]
+	if !ok {
+		return nil, false
+	}
+	return r.clone(), true
+}
+
+// Save 添加或更新记录并写入文件，保存的是 r 的拷贝
+func (s *LinkStore) Save(r *MessageRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r.UpdatedAt = time.Now()
+	s.put(r.clone())
+	s.prune()
+	return s.flush()
+}
+
+// Update 持有锁时用 fn 修改记录并写入文件，记录不存在时返回 false
+// fn 中不能有网络请求等耗时操作
+func (s *LinkStore) Update(peerID int64, messageID int, fn func(r *MessageRecord)) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.index[recordKey(peerID, messageID)]
+	if !ok {
+		return false, nil
+	}
+	r, ok := s.records[key]
+	if !ok {
+		return false, nil
+	}
+	fn(r)
+	r.UpdatedAt = time.Now()
+	return true, s.flush()
+}
+
+// MarkDeleted 将频道中被删除的消息标记为已删除，返回受影响的记录
+func (s *LinkStore) MarkDeleted(peerID int64, messageIDs []int) ([]*MessageRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var affected []*MessageRecord
+	seen := make(map[string]bool)
+	for _, id := range messageIDs {
+		key, ok := s.index[recordKey(peerID, id)]
+		if !ok || seen[key] {
+			continue
+		}
+		seen[key] = true
+		r := s.records[key]
+		if r == nil || r.Deleted {
+			continue
+		}
+		r.Deleted = true
+		r.DeletedAt = &now
+		r.UpdatedAt = now
+		affected = append(affected, r.clone())
+	}
+	if len(affected) == 0 {
+		return nil, nil
+	}
+	return affected, s.flush()
+}
+
+// FailedRecords 返回包含提交失败链接的记录
+func (s *LinkStore) FailedRecords() []*MessageRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var failed []*MessageRecord
+	for _, r := range s.records {
+		for _, l := range r.Links {
+			if l.Status == Failed {
+				failed = append(failed, r.clone())
+				break
+			}
+		}
+	}
+	sort.Slice(failed, func(i, j int) bool {
+		return failed[i].Date < failed[j].Date
+	})
+	return failed
+}
+
+// Recent 返回最近更新的 n 条记录，最新的在前
+func (s *LinkStore) Recent(n int) []*MessageRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := make([]*MessageRecord, 0, len(s.records))
+	for _, r := range s.records {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].UpdatedAt.After(records[j].UpdatedAt)
+	})
+	if len(records) > n {
+		records = records[:n]
+	}
+	for i, r := range records {
+		records[i] = r.clone()
+	}
+	return records
+}
+
+// Between 返回消息时间在 [since, until) 内的记录，按消息时间排序，零值表示不限制
+func (s *LinkStore) Between(since, until time.Time) []*MessageRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var records []*MessageRecord
+	for _, r := range s.records {
+		date := time.Unix(int64(r.Date), 0)
+		if (!since.IsZero() && date.Before(since)) || (!until.IsZero() && !date.Before(until)) {
+			continue
+		}
+		records = append(records, r.clone())
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Date < records[j].Date
+	})
+	return records
+}
+
+// FindLink 返回包含该链接的所有记录
+func (s *LinkStore) FindLink(url string) []*MessageRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var found []*MessageRecord
+	for _, r := range s.records {
+		if r.HasLink(url) {
+			found = append(found, r.clone())
+		}
+	}
+	return found
+}
+
+// ChannelStatus 返回频道上次记录的访问状态
+func (s *LinkStore) ChannelStatus(channelID int64) (ChannelStatus, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, ok := s.channels[channelID]
+	if !ok {
+		return ChannelStatus{}, false
+	}
+	return *status, true
+}
+
+// SetChannelStatus 记录频道的访问状态
+func (s *LinkStore) SetChannelStatus(channelID int64, status ChannelStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status.UpdatedAt = time.Now()
+	s.channels[channelID] = &status
+	return s.flush()
+}
+
+// prune 删除超过保留时间的记录（调用方需持有锁）
+func (s *LinkStore) prune() {
+	if s.retention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-s.retention)
+	for key, r := range s.records {
+		if r.UpdatedAt.Before(cutoff) {
+			delete(s.records, key)
+			for _, id := range r.MessageIDs {
+				delete(s.index, recordKey(r.PeerID, id))
+			}
+		}
+	}
+}
+
+// flush 将所有记录写入文件，先写临时文件再改名（调用方需持有锁）
+func (s *LinkStore) flush() error {
+	records := make([]*MessageRecord, 0, len(s.records))
+	for _, r := range s.records {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].UpdatedAt.Before(records[j].UpdatedAt)
+	})
+	data, err := json.MarshalIndent(linkFile{Records: records, Channels: s.channels}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("编码链接记录失败: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("写入链接记录失败: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("写入链接记录失败: %w", err)
+	}
+	return nil
+}
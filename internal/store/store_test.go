@@ -0,0 +1,82 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestStore 在临时目录中创建链接记录
+func newTestStore(t *testing.T) (*LinkStore, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "links.json")
+	s, err := NewLinkStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, path
+}
+
+func TestLinkStoreReturnsCopies(t *testing.T) {
+	s, _ := newTestStore(t)
+	r := &MessageRecord{PeerID: 1, MessageIDs: []int{10}, Links: []*LinkRecord{{URL: "https://example.com/a", Status: Submitted}}}
+	if err := s.Save(r); err != nil {
+		t.Fatal(err)
+	}
+
+	// 保存后修改调用方的记录，不影响已保存的记录
+	r.Links[0].Status = Failed
+	got, ok := s.Get(1, 10)
+	if !ok || got.Links[0].Status != Submitted {
+		t.Fatalf("Get() = %+v, %v", got, ok)
+	}
+
+	// 修改查询结果，不影响已保存的记录
+	got.Links[0].Status = Removed
+	got.Links = append(got.Links, &LinkRecord{URL: "https://example.com/b"})
+	got.MessageIDs[0] = 11
+	for name, records := range map[string][]*MessageRecord{
+		"Recent":   s.Recent(10),
+		"FindLink": s.FindLink("https://example.com/a"),
+		"Between":  s.Between(time.Time{}, time.Time{}),
+	} {
+		if len(records) != 1 || len(records[0].Links) != 1 || records[0].Links[0].Status != Submitted || records[0].MessageIDs[0] != 10 {
+			t.Errorf("%s() = %+v", name, records)
+		}
+	}
+}
+
+func TestLinkStoreUpdate(t *testing.T) {
+	s, path := newTestStore(t)
+	r := &MessageRecord{PeerID: 1, MessageIDs: []int{10, 11}, Links: []*LinkRecord{{URL: "https://example.com/a", Status: Failed}}}
+	if err := s.Save(r); err != nil {
+		t.Fatal(err)
+	}
+	if failed := s.FailedRecords(); len(failed) != 1 {
+		t.Fatalf("FailedRecords() = %+v", failed)
+	}
+
+	// 相册中任意一条消息都能找到记录
+	ok, err := s.Update(1, 11, func(r *MessageRecord) {
+		r.Links[0].Status = Submitted
+	})
+	if !ok || err != nil {
+		t.Fatalf("Update() = %v, %v", ok, err)
+	}
+	if ok, err := s.Update(1, 12, func(*MessageRecord) { t.Error("记录不存在时不应调用 fn") }); ok || err != nil {
+		t.Errorf("Update() 不存在的记录 = %v, %v", ok, err)
+	}
+	if failed := s.FailedRecords(); len(failed) != 0 {
+		t.Errorf("FailedRecords() = %+v", failed)
+	}
+
+	// 修改已写入文件
+	reopened, err := NewLinkStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := reopened.Get(1, 10)
+	if !ok || got.Links[0].Status != Submitted {
+		t.Errorf("重新打开后 Get() = %+v, %v", got, ok)
+	}
+}
@@ -0,0 +1,139 @@
+// Package tgclient 创建 Telegram 客户端，处理登录和会话失效
+package tgclient
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/telegram/dcs"
+	"github.com/gotd/td/telegram/updates"
+	updhook "github.com/gotd/td/telegram/updates/hook"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"go.uber.org/zap"
+)
+
+// Options 客户端配置
+type Options struct {
+	AppID       int
+	AppHash     string
+	SessionFile string
+	Gaps        *updates.Manager // 更新处理器，同时通过 UpdateHook 接收 RPC 返回中的更新
+	Resolver    dcs.Resolver     // 为 nil 时直连
+	Logger      *zap.Logger      // gotd 内部日志，为 nil 时不输出
+}
+
+// New 创建 Telegram 客户端
+func New(opts Options) *telegram.Client {
+	o := telegram.Options{
+		SessionStorage: &telegram.FileSessionStorage{Path: opts.SessionFile},
+		DialTimeout:    30 * time.Second, // 每个连接30秒超时
+		Resolver:       opts.Resolver,
+		Logger:         opts.Logger,
+	}
+	if opts.Gaps != nil {
+		o.UpdateHandler = opts.Gaps // 设置 gaps 为更新处理器
+		o.Middlewares = []telegram.Middleware{
+			updhook.UpdateHook(opts.Gaps.Handle), // 关键：添加 UpdateHook 中间件
+		}
+	}
+	return telegram.NewClient(opts.AppID, opts.AppHash, o)
+}
+
+// Authenticate 未登录时在终端输入手机号、验证码和两步验证密码登录
+func Authenticate(ctx context.Context, client *telegram.Client) error {
+	return client.Auth().IfNecessary(
+		ctx,
+		auth.NewFlow(
+			&terminalAuth{},
+			auth.SendCodeOptions{},
+		),
+	)
+}
+
+// Self 返回当前登录的用户
+func Self(ctx context.Context, api *tg.Client) (*tg.User, error) {
+	users, err := api.UsersGetUsers(ctx, []tg.InputUserClass{&tg.InputUserSelf{}})
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("没有返回当前用户")
+	}
+	user, ok := users[0].(*tg.User)
+	if !ok {
+		return nil, fmt.Errorf("当前用户不可用")
+	}
+	return user, nil
+}
+
+// 需要重新登录的错误，会话已经失效，重试没有意义
+var reloginErrors = []string{
+	"AUTH_KEY_UNREGISTERED",
+	"AUTH_KEY_INVALID",
+	"AUTH_KEY_DUPLICATED",
+	"SESSION_REVOKED",
+	"SESSION_EXPIRED",
+	"USER_DEACTIVATED",
+	"USER_DEACTIVATED_BAN",
+}
+
+// NeedRelogin 判断错误是否意味着会话失效、需要重新登录
+func NeedRelogin(err error) bool {
+	return tgerr.Is(err, reloginErrors...) || auth.IsUnauthorized(err)
+}
+
+// BackupSession 将失效的会话文件改名备份，下次启动时重新走登录流程
+// 返回备份文件名，会话文件不存在时返回空字符串
+func BackupSession(path string) (string, error) {
+	backup := fmt.Sprintf("%s.%s.bak", path, time.Now().Format("20060102-150405"))
+	if err := os.Rename(path, backup); err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("备份会话文件失败: %w", err)
+	}
+	return backup, nil
+}
+
+// terminalAuth 终端认证器
+type terminalAuth struct{}
+
+func (terminalAuth) Phone(_ context.Context) (string, error) {
+	fmt.Print("请输入手机号（国际格式，如 +8613800138000）: ")
+	phone, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("读取手机号失败: %w", err)
+	}
+	phone = strings.TrimSpace(phone)
+	return phone, nil
+}
+
+func (terminalAuth) Password(_ context.Context) (string, error) {
+	fmt.Print("请输入密码（如果启用了两步验证）: ")
+	pwd, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("读取密码失败: %w", err)
+	}
+	return strings.TrimSpace(pwd), nil
+}
+
+func (terminalAuth) Code(_ context.Context, _ *tg.AuthSentCode) (string, error) {
+	fmt.Print("请输入收到的验证码: ")
+	code, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(code), err
+}
+
+func (terminalAuth) AcceptTermsOfService(_ context.Context, tos tg.HelpTermsOfService) error {
+	return nil
+}
+
+func (terminalAuth) SignUp(_ context.Context) (auth.UserInfo, error) {
+	return auth.UserInfo{}, fmt.Errorf("需要注册")
+}
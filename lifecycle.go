@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gotd/td/tg"
+
+	"simple-listener/internal/store"
+)
+
+// handleDeleteChannelMessages 频道消息被删除时，在链接记录中标记对应的消息
+func (l *listener) handleDeleteChannelMessages(ctx context.Context, e tg.Entities, update *tg.UpdateDeleteChannelMessages) error {
+	records, err := l.links.MarkDeleted(update.ChannelID, update.Messages)
+	if err != nil {
+		logStore.Error("保存链接记录失败", "error", err)
+	}
+	if l.archive != nil {
+		if err := l.archive.MarkDeleted(update.ChannelID, update.Messages); err != nil {
+			logStore.Error("归档消息失败", "error", err)
+		}
+	}
+	for _, r := range records {
+		links := make([]string, 0, len(r.Links))
+		for _, link := range r.Links {
+			links = append(links, fmt.Sprintf("%s (%s)", link.URL, link.Status))
+		}
+		logUpdates.Info("频道删除了已处理的消息", "source", r.Source, "messages", r.MessageIDs, "links", links)
+	}
+	return nil
+}
+
+// handleChannelUpdate 频道状态变化（被移出、封禁、删除等）时检查监听的频道是否仍可访问
+func (l *listener) handleChannelUpdate(ctx context.Context, e tg.Entities, update *tg.UpdateChannel) error {
+	channelID := update.ChannelID
+	if !l.isMonitoredChannel(channelID) {
+		return nil
+	}
+
+	var status store.ChannelStatus
+	if ch, ok := e.Channels[channelID]; ok {
+		status = channelStatusOf(ch)
+	} else {
+		status = checkChannelAccess(ctx, channelID)
+	}
+	l.recordChannelStatus(channelID, status)
+	return nil
+}
+
+// isMonitoredChannel 判断是否是监听的频道（包括讨论组）
+func (l *listener) isMonitoredChannel(channelID int64) bool {
+	if _, ok := registry.discussionParent(channelID); ok {
+		return true
+	}
+	return slices.Contains(l.monitorChannels(), channelID)
+}
+
+// channelStatusOf 根据频道信息判断访问状态
+func channelStatusOf(ch *tg.Channel) store.ChannelStatus {
+	if ch.Left {
+		return store.ChannelStatus{Title: ch.Title, Reason: "已退出频道"}
+	}
+	return store.ChannelStatus{Title: ch.Title, Accessible: true}
+}
+
+// checkChannelAccess 通过 API 查询频道是否仍可访问
+func checkChannelAccess(ctx context.Context, channelID int64) store.ChannelStatus {
+	api := tgAPI.Load()
+	if api == nil {
+		return store.ChannelStatus{Accessible: true}
+	}
+
+	var accessHash int64
+	if accessHasher != nil {
+		if hash, found, err := accessHasher.GetChannelAccessHash(ctx, selfID.Load(), channelID); err == nil && found {
+			accessHash = hash
+		}
+	}
+
+	chats, err := api.ChannelsGetChannels(ctx, []tg.InputChannelClass{
+		&tg.InputChannel{ChannelID: channelID, AccessHash: accessHash},
+	})
+	if err != nil {
+		// CHANNEL_PRIVATE / CHANNEL_INVALID 等：频道已被删除或无权访问
+		return store.ChannelStatus{Reason: err.Error()}
+	}
+	for _, chat := range chats.GetChats() {
+		switch ch := chat.(type) {
+		case *tg.Channel:
+			return channelStatusOf(ch)
+		case *tg.ChannelForbidden:
+			reason := "已被封禁或移出频道"
+			if ch.UntilDate != 0 {
+				reason += fmt.Sprintf("（解封时间 %s）", time.Unix(int64(ch.UntilDate), 0).Format("2006-01-02 15:04:05"))
+			}
+			return store.ChannelStatus{Title: ch.Title, Reason: reason}
+		}
+	}
+	return store.ChannelStatus{Reason: "频道不存在"}
+}
+
+// recordChannelStatus 记录频道状态，状态变化时输出警告
+func (l *listener) recordChannelStatus(channelID int64, status store.ChannelStatus) {
+	prev, found := l.links.ChannelStatus(channelID)
+	if err := l.links.SetChannelStatus(channelID, status); err != nil {
+		logStore.Error("保存频道状态失败", "error", err)
+	}
+
+	switch {
+	case !status.Accessible && (!found || prev.Accessible):
+		logUpdates.Warn("监听的频道无法访问", "channel", channelID, "title", status.Title, "reason", status.Reason)
+	case status.Accessible && found && !prev.Accessible:
+		logUpdates.Info("监听的频道已恢复访问", "channel", channelID, "title", status.Title)
+	}
+}
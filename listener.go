@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gotd/td/tg"
+
+	"simple-listener/internal/config"
+	"simple-listener/internal/filter"
+	"simple-listener/internal/sink"
+	"simple-listener/internal/store"
+)
+
+// listener 处理 Telegram 更新：执行过滤链、提交链接、记录和归档处理结果
+// 由 main 按配置创建，各个更新处理器、控制命令和管理 API 共用同一个过滤链
+type listener struct {
+	settings   settings
+	configPath string // 控制命令修改监听频道和关键词后写回该文件
+	pipeline   *filter.Pipeline
+	links      *store.LinkStore // 消息与链接记录，为 nil 时不记录
+
+	archive  *store.Archive // 消息归档，为 nil 时不归档
+	albums   *albumBuffer   // 相册消息缓冲，为 nil 时不合并相册
+	forwards *forwarder     // 匹配消息转发，为 nil 时不转发
+	notices  *notifier      // 订阅结果通知，为 nil 时不通知
+	commands *controller    // 控制命令，为 nil 时不处理命令
+
+	paused atomic.Bool // 暂停处理新消息，由 /pause 和 /resume 命令切换
+
+	mu  sync.RWMutex
+	cfg config.Config // 当前配置，监听频道和关键词可以被控制命令修改
+}
+
+// newListener 按配置创建过滤链，通过过滤的链接提交到 linkSink
+// 归档、相册合并、转发、通知和控制命令由调用方按配置设置
+func newListener(configPath string, c config.Config, s settings, links *store.LinkStore, linkSink sink.Sink) *listener {
+	return &listener{
+		settings:   s,
+		configPath: configPath,
+		pipeline:   filter.NewPipeline(filterConfig(c), linkSink),
+		links:      links,
+		cfg:        c,
+	}
+}
+
+// ownMessage 判断是否是自己发送的消息，或转发、通知、控制命令所在对话中的消息，返回跳过的原因
+// 这些消息不参与过滤，避免转发出去的消息和通知在监听所有频道时被再次提交和转发
+func (l *listener) ownMessage(msg *tg.Message) string {
+	switch {
+	case msg.Out:
+		return "自己发送的消息"
+	case l.forwards != nil && l.forwards.isTarget(msg.PeerID):
+		return "转发目标对话中的消息"
+	case l.notices != nil && l.notices.isTarget(msg.PeerID):
+		return "通知目标对话中的消息"
+	case l.commands != nil && l.commands.isControlChat(msg.PeerID):
+		return "控制对话中的消息"
+	}
+	return ""
+}
+
+// filterConfig 返回配置中的过滤规则
+func filterConfig(c config.Config) filter.Config {
+	return filter.Config{
+		Keywords:          c.Filters.Keywords,
+		ContentFilter:     c.Filters.ContentFilter,
+		LinkBlacklist:     c.Filters.LinkBlacklist,
+		WhitelistChannels: c.Monitor.WhitelistChannels,
+		OriginWhitelist:   c.Monitor.OriginWhitelist,
+	}
+}
+
+// currentConfig 返回当前配置，包括被控制命令修改过的监听频道和关键词
+func (l *listener) currentConfig() config.Config {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.cfg
+}
+
+// monitorChannels 返回当前监听的频道，为空时监听所有频道
+func (l *listener) monitorChannels() []int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.cfg.Monitor.Channels
+}
+
+// updateMonitorChannels 添加或移除监听频道并写回配置文件，返回修改后的频道列表
+func (l *listener) updateMonitorChannels(add bool, channelID int64) ([]int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	channels := l.cfg.Monitor.Channels
+	exists := slices.Contains(channels, channelID)
+	switch {
+	case add && exists:
+		return nil, fmt.Errorf("频道 %d 已在监听列表中", channelID)
+	case !add && !exists:
+		return nil, fmt.Errorf("频道 %d 不在监听列表中", channelID)
+	case add:
+		channels = append(slices.Clone(channels), channelID)
+	default:
+		channels = slices.DeleteFunc(slices.Clone(channels), func(id int64) bool { return id == channelID })
+	}
+
+	l.cfg.Monitor.Channels = channels
+	if err := config.SaveValue(l.configPath, []string{"monitor", "channels"}, channels); err != nil {
+		return channels, fmt.Errorf("已生效，但保存配置失败: %w", err)
+	}
+	return channels, nil
+}
+
+// updateKeywords 添加或移除关键词并写回配置文件，返回修改后的关键词列表
+func (l *listener) updateKeywords(add bool, word string) ([]string, error) {
+	word = strings.TrimSpace(word)
+	if word == "" {
+		return nil, fmt.Errorf("关键词不能为空")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	err := l.pipeline.Update(func(c *filter.Config) error {
+		exists := slices.Contains(c.Keywords, word)
+		switch {
+		case add && exists:
+			return fmt.Errorf("关键词已存在: %s", word)
+		case !add && !exists:
+			return fmt.Errorf("关键词不存在: %s", word)
+		case add:
+			c.Keywords = append(slices.Clone(c.Keywords), word)
+		default:
+			c.Keywords = slices.DeleteFunc(slices.Clone(c.Keywords), func(k string) bool { return k == word })
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	keywords := l.pipeline.Config().Keywords
+	l.cfg.Filters.Keywords = keywords
+	if err := config.SaveValue(l.configPath, []string{"filters", "keywords"}, keywords); err != nil {
+		return keywords, fmt.Errorf("已生效，但保存配置失败: %w", err)
+	}
+	return keywords, nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"simple-listener/internal/config"
+)
+
+// 各组件的日志，日志中带 component 字段，可以按组件单独设置级别
+var (
+	logMain     *slog.Logger // 启动、配置、重连
+	logAuth     *slog.Logger // 登录和会话
+	logDial     *slog.Logger // 连接 Telegram DC
+	logProxy    *slog.Logger // 代理池
+	logUpdates  *slog.Logger // 更新接收和频道状态
+	logChannels *slog.Logger // 频道、讨论组、话题解析
+	logFilter   *slog.Logger // 消息过滤和链接提取
+	logSink     *slog.Logger // 订阅 API、转发、通知
+	logStore    *slog.Logger // 链接记录
+	logControl  *slog.Logger // 控制命令
+	logHTTP     *slog.Logger // 管理 API、指标和健康检查服务
+)
+
+func init() {
+	// 加载配置前使用默认的文本日志
+	setLoggers(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}), slog.LevelInfo, nil)
+}
+
+// setupLogging 按配置初始化日志，返回 gotd 使用的 zap 日志
+func setupLogging(cfg config.LogConfig) (*zap.Logger, error) {
+	level, err := parseLogLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	components := make(map[string]slog.Level, len(cfg.Components))
+	for name, raw := range cfg.Components {
+		if components[name], err = parseLogLevel(raw); err != nil {
+			return nil, fmt.Errorf("组件 %s: %w", name, err)
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if cfg.File != "" {
+		out = io.MultiWriter(os.Stdout, &lumberjack.Logger{
+			Filename:   cfg.File,
+			MaxSize:    cfg.MaxSize,
+			MaxBackups: cfg.MaxBackups,
+			MaxAge:     cfg.MaxAge,
+		})
+	}
+
+	// 根 handler 输出所有级别，由各组件自己的级别过滤
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var root slog.Handler
+	switch cfg.Format {
+	case "", "text":
+		root = slog.NewTextHandler(out, opts)
+	case "json":
+		root = slog.NewJSONHandler(out, opts)
+	default:
+		return nil, fmt.Errorf("不支持的日志格式: %s", cfg.Format)
+	}
+	setLoggers(root, level, components)
+
+	if cfg.GotdLevel == "" {
+		return zap.NewNop(), nil
+	}
+	gotdLevel, err := parseLogLevel(cfg.GotdLevel)
+	if err != nil {
+		return nil, fmt.Errorf("gotd_level: %w", err)
+	}
+	core := &slogCore{
+		handler: root.WithAttrs([]slog.Attr{slog.String("component", "gotd")}),
+		level:   gotdLevel,
+	}
+	return zap.New(core), nil
+}
+
+// setLoggers 创建各组件的日志
+func setLoggers(root slog.Handler, level slog.Level, components map[string]slog.Level) {
+	logger := func(name string) *slog.Logger {
+		l, ok := components[name]
+		if !ok {
+			l = level
+		}
+		h := &levelHandler{level: l, Handler: root.WithAttrs([]slog.Attr{slog.String("component", name)})}
+		return slog.New(h)
+	}
+
+	logMain = logger("main")
+	logAuth = logger("auth")
+	logDial = logger("dial")
+	logProxy = logger("proxy")
+	logUpdates = logger("updates")
+	logChannels = logger("channels")
+	logFilter = logger("filter")
+	logSink = logger("sink")
+	logStore = logger("store")
+	logControl = logger("control")
+	logHTTP = logger("http")
+	slog.SetDefault(logMain)
+}
+
+// parseLogLevel 解析日志级别，为空时为 info
+func parseLogLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(strings.ToUpper(s))); err != nil {
+		return level, fmt.Errorf("无效的日志级别: %s", s)
+	}
+	return level, nil
+}
+
+// levelHandler 为单个组件设置日志级别
+type levelHandler struct {
+	level slog.Level
+	slog.Handler
+}
+
+func (h *levelHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{level: h.level, Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{level: h.level, Handler: h.Handler.WithGroup(name)}
+}
+
+// slogCore 将 gotd 的 zap 日志转发到 slog，和程序日志使用同一个输出
+type slogCore struct {
+	handler slog.Handler
+	level   slog.Level
+	fields  []zapcore.Field
+}
+
+var _ zapcore.Core = (*slogCore)(nil)
+
+func (c *slogCore) Enabled(level zapcore.Level) bool {
+	return zapToSlogLevel(level) >= c.level
+}
+
+func (c *slogCore) With(fields []zapcore.Field) zapcore.Core {
+	return &slogCore{
+		handler: c.handler,
+		level:   c.level,
+		fields:  append(append([]zapcore.Field{}, c.fields...), fields...),
+	}
+}
+
+func (c *slogCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *slogCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	record := slog.NewRecord(entry.Time, zapToSlogLevel(entry.Level), entry.Message, 0)
+	if entry.LoggerName != "" {
+		record.AddAttrs(slog.String("logger", entry.LoggerName))
+	}
+
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	keys := make([]string, 0, len(enc.Fields))
+	for k := range enc.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		record.AddAttrs(slog.Any(k, enc.Fields[k]))
+	}
+	return c.handler.Handle(context.Background(), record)
+}
+
+func (c *slogCore) Sync() error {
+	return nil
+}
+
+// zapToSlogLevel 转换日志级别，DPanic 及以上都按 error 输出
+func zapToSlogLevel(level zapcore.Level) slog.Level {
+	switch {
+	case level <= zapcore.DebugLevel:
+		return slog.LevelDebug
+	case level == zapcore.InfoLevel:
+		return slog.LevelInfo
+	case level == zapcore.WarnLevel:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
@@ -1,171 +1,319 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net"
 	"net/http"
-	"net/url"
 	"os"
 	"os/signal"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gotd/td/telegram"
-	"github.com/gotd/td/telegram/auth"
 	"github.com/gotd/td/telegram/dcs"
 	"github.com/gotd/td/telegram/updates"
-	updhook "github.com/gotd/td/telegram/updates/hook"
 	"github.com/gotd/td/tg"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
 	"golang.org/x/net/proxy"
-	"gopkg.in/yaml.v3"
-)
 
-// 配置结构体
-type Config struct {
-	API struct {
-		ApiID       int    `yaml:"api_id"`
-		ApiHash     string `yaml:"api_hash"`
-		SessionFile string `yaml:"session_file"`
-		ProxyAddr   string `yaml:"proxy_addr"`
-	} `yaml:"api"`
-	
-	SubscriptionAPI struct {
-		Host   string `yaml:"host"`
-		ApiKey string `yaml:"api_key"`
-	} `yaml:"subscription_api"`
-	
-	Features struct {
-		FetchHistoryEnabled bool `yaml:"fetch_history_enabled"`
-	} `yaml:"features"`
-	
-	Monitor struct {
-		Channels          []int64 `yaml:"channels"`
-		WhitelistChannels []int64 `yaml:"whitelist_channels"`
-	} `yaml:"monitor"`
-	
-	Filters struct {
-		Keywords      []string `yaml:"keywords"`
-		ContentFilter []string `yaml:"content_filter"`
-		LinkBlacklist []string `yaml:"link_blacklist"`
-	} `yaml:"filters"`
-}
+	"simple-listener/internal/config"
+	"simple-listener/internal/filter"
+	"simple-listener/internal/sink"
+	"simple-listener/internal/store"
+	"simple-listener/internal/tgclient"
+)
 
-// 全局配置变量
-var config Config
+// 配置文件路径，控制命令修改配置后写回该文件
+const configFile = "config.yaml"
 
-// 加载配置文件
-func loadConfig(filename string) error {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return fmt.Errorf("读取配置文件失败: %w", err)
-	}
-	
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return fmt.Errorf("解析配置文件失败: %w", err)
-	}
-	
-	return nil
-}
+// gotd 内部日志，由 log.gotd_level 控制
+var gotdLogger = zap.NewNop()
 
-// 兼容性：保留旧的变量名，从配置中读取
-var (
+// settings 从配置中读取并补上默认值的运行参数，启动后不再修改
+// 可以被控制命令修改的监听频道和关键词由 listener 维护
+type settings struct {
 	ApiID       int
 	ApiHash     string
 	SessionFile string
-	ProxyAddr   string
-	
-	SubscriptionAPIHost string
-	SubscriptionAPIKey  string
-	
+	StateFile   string
+
+	ProxyURLs          []string
+	ProxyStrategy      string
+	ProxyCheckInterval time.Duration
+
+	SubscriptionAPIHost        string
+	SubscriptionAPIKey         string
+	SubscriptionAPIUseProxy    bool
+	SubscriptionAPIRetractPath string
+	SubscriptionAPIDryRun      bool
+
+	StoreFile      string
+	StoreRetention time.Duration
+
+	ArchiveEnabled   bool
+	ArchiveFile      string
+	ArchiveRetention time.Duration
+
+	ForwardEnabled  bool
+	ForwardTarget   string
+	ForwardMode     string
+	ForwardTemplate string
+	ForwardRate     int
+	ForwardDryRun   bool
+
+	NotifyEnabled          bool
+	NotifyTarget           string
+	NotifyLinkResults      bool
+	NotifyDigest           string
+	NotifyFailureThreshold int
+	NotifyDryRun           bool
+
+	ControlEnabled bool
+	ControlChat    string
+
+	AdminEnabled bool
+	AdminListen  string
+	AdminToken   string
+
+	MetricsEnabled bool
+	MetricsListen  string
+
+	HealthEnabled      bool
+	HealthListen       string
+	HealthReadyTimeout time.Duration
+	HealthUpdateWindow time.Duration
+
 	FetchHistoryEnabled bool
-	
-	Keywords         []string
-	ContentFilter    []string
-	LinkBlacklist    []string
-	MonitorChannels  []int64
-	WhitelistChannels []int64
-)
+	RetractOnEdit       bool
+	AlbumWindow         time.Duration // 0 表示不合并相册
+	Documents           documentOptions
 
-// 初始化配置变量
-func initConfigVars() {
-	ApiID = config.API.ApiID
-	ApiHash = config.API.ApiHash
-	SessionFile = config.API.SessionFile
-	ProxyAddr = config.API.ProxyAddr
-	
-	SubscriptionAPIHost = config.SubscriptionAPI.Host
-	SubscriptionAPIKey = config.SubscriptionAPI.ApiKey
-	
-	FetchHistoryEnabled = config.Features.FetchHistoryEnabled
-	
-	Keywords = config.Filters.Keywords
-	ContentFilter = config.Filters.ContentFilter
-	LinkBlacklist = config.Filters.LinkBlacklist
-	
-	MonitorChannels = config.Monitor.Channels
-	WhitelistChannels = config.Monitor.WhitelistChannels
+	ReconnectInitialDelay time.Duration
+	ReconnectMaxDelay     time.Duration
+	StallTimeout          time.Duration
+
+	IgnoreForwardsFrom []int64
+	ChannelOptions     map[int64]config.ChannelOptions
+}
+
+// newSettings 从配置中读取运行参数
+func newSettings(c config.Config) settings {
+	s := settings{
+		ApiID:       c.API.ApiID,
+		ApiHash:     c.API.ApiHash,
+		SessionFile: c.API.SessionFile,
+		StateFile:   c.API.StateFile,
+
+		ProxyURLs:          c.API.Proxies,
+		ProxyStrategy:      c.API.ProxyStrategy,
+		ProxyCheckInterval: secondsOr(c.API.ProxyCheckInterval, 60*time.Second),
+
+		SubscriptionAPIHost:        c.SubscriptionAPI.Host,
+		SubscriptionAPIKey:         c.SubscriptionAPI.ApiKey,
+		SubscriptionAPIUseProxy:    c.SubscriptionAPI.UseProxy,
+		SubscriptionAPIRetractPath: c.SubscriptionAPI.RetractPath,
+		SubscriptionAPIDryRun:      c.DryRun || c.SubscriptionAPI.DryRun,
+
+		StoreFile:      c.Store.File,
+		StoreRetention: time.Duration(c.Store.RetentionDays) * 24 * time.Hour,
+
+		ArchiveEnabled:   c.Archive.Enabled,
+		ArchiveFile:      c.Archive.File,
+		ArchiveRetention: time.Duration(c.Archive.RetentionDays) * 24 * time.Hour,
+
+		ForwardEnabled:  c.Forward.Enabled,
+		ForwardTarget:   c.Forward.Target,
+		ForwardMode:     c.Forward.Mode,
+		ForwardTemplate: c.Forward.Template,
+		ForwardRate:     c.Forward.Rate,
+		ForwardDryRun:   c.DryRun || c.Forward.DryRun,
+
+		NotifyEnabled:          c.Notify.Enabled,
+		NotifyTarget:           c.Notify.Target,
+		NotifyLinkResults:      c.Notify.LinkResults,
+		NotifyDigest:           c.Notify.Digest,
+		NotifyFailureThreshold: c.Notify.FailureThreshold,
+		NotifyDryRun:           c.DryRun || c.Notify.DryRun,
+
+		ControlEnabled: c.Control.Enabled,
+		ControlChat:    c.Control.Chat,
+
+		AdminEnabled: c.Admin.Enabled,
+		AdminListen:  c.Admin.Listen,
+		AdminToken:   c.Admin.Token,
+
+		MetricsEnabled: c.Metrics.Enabled,
+		MetricsListen:  c.Metrics.Listen,
+
+		HealthEnabled:      c.Health.Enabled,
+		HealthListen:       c.Health.Listen,
+		HealthReadyTimeout: time.Duration(c.Health.ReadyTimeout) * time.Second,
+		// 收不到更新不一定是连接卡住（账号所在的频道可能很久没有消息），默认不检查
+		HealthUpdateWindow: time.Duration(c.Health.UpdateWindow) * time.Second,
+
+		FetchHistoryEnabled: c.Features.FetchHistoryEnabled,
+		RetractOnEdit:       c.Features.RetractOnEdit && c.SubscriptionAPI.RetractPath != "",
+		Documents: documentOptions{
+			Scan:       c.Features.ScanDocuments,
+			MaxSize:    c.Features.DocumentMaxSize,
+			Extensions: c.Features.DocumentExtensions,
+		},
+
+		ReconnectInitialDelay: secondsOr(c.Reconnect.InitialDelay, 2*time.Second),
+		ReconnectMaxDelay:     secondsOr(c.Reconnect.MaxDelay, 5*time.Minute),
+		StallTimeout:          secondsOr(c.Reconnect.StallTimeout, 60*time.Second),
+
+		IgnoreForwardsFrom: c.Monitor.IgnoreForwardsFrom,
+		ChannelOptions:     c.Monitor.ChannelOptions,
+	}
+
+	if s.StateFile == "" {
+		s.StateFile = "updates_state.json"
+	}
+	proxyURL := c.API.Proxy
+	if proxyURL == "" && c.API.ProxyAddr != "" {
+		proxyURL = "socks5://" + c.API.ProxyAddr
+	}
+	if len(s.ProxyURLs) == 0 {
+		s.ProxyURLs = []string{proxyURL}
+	}
+
+	if s.StoreFile == "" {
+		s.StoreFile = "links.json"
+	}
+	if c.Store.RetentionDays == 0 {
+		s.StoreRetention = 30 * 24 * time.Hour
+	}
+	if s.ArchiveFile == "" {
+		s.ArchiveFile = "archive.db"
+	}
+
+	if s.AdminListen == "" {
+		s.AdminListen = "127.0.0.1:8080"
+	}
+	if s.MetricsListen == "" {
+		s.MetricsListen = "127.0.0.1:9090"
+	}
+	if s.HealthListen == "" {
+		s.HealthListen = s.MetricsListen
+	}
+	if c.Health.ReadyTimeout == 0 {
+		s.HealthReadyTimeout = 15 * time.Minute
+	}
+
+	switch {
+	case c.Features.AlbumWindow < 0:
+		s.AlbumWindow = 0
+	case c.Features.AlbumWindow == 0:
+		s.AlbumWindow = 1500 * time.Millisecond
+	default:
+		s.AlbumWindow = time.Duration(c.Features.AlbumWindow) * time.Millisecond
+	}
+
+	if s.Documents.MaxSize <= 0 {
+		s.Documents.MaxSize = 64 * 1024
+	}
+	if len(s.Documents.Extensions) == 0 {
+		s.Documents.Extensions = []string{".txt", ".yaml", ".yml", ".conf", ".json", ".list"}
+	}
+	return s
+}
+
+// secondsOr 将配置中的秒数转换为 time.Duration，未配置时使用默认值
+func secondsOr(seconds int, def time.Duration) time.Duration {
+	if seconds <= 0 {
+		return def
+	}
+	return time.Duration(seconds) * time.Second
 }
 
 func main() {
+	// 子命令
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "search":
+			os.Exit(runSearch(os.Args[2:]))
+		case "export":
+			os.Exit(runExport(os.Args[2:]))
+		case "replay":
+			os.Exit(runReplay(os.Args[2:]))
+		}
+	}
+
 	// 加载配置文件
-	if err := loadConfig("config.yaml"); err != nil {
-		fmt.Printf("❌ 配置文件加载失败: %v\n", err)
-		fmt.Println("💡 提示: 请确保 config.yaml 文件存在")
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		logMain.Error("配置文件加载失败，请确保 config.yaml 文件存在", "error", err)
 		return
 	}
+	s := newSettings(cfg)
 	
-	// 初始化配置变量
-	initConfigVars()
+	// 按配置初始化日志，gotd 的日志也输出到同一位置
+	gotdLogger, err = setupLogging(cfg.Log)
+	if err != nil {
+		logMain.Error("日志配置错误", "error", err)
+		return
+	}
 	
-	fmt.Println("✅ 配置文件加载成功")
-	fmt.Printf("📝 监听 %d 个频道\n", len(MonitorChannels))
-	fmt.Printf("📝 关键词数量: %d\n", len(Keywords))
-	fmt.Printf("📝 白名单频道数量: %d\n", len(WhitelistChannels))
-	fmt.Println()
+	logMain.Info("配置文件加载成功",
+		"channels", len(cfg.Monitor.Channels),
+		"keywords", len(cfg.Filters.Keywords),
+		"whitelist_channels", len(cfg.Monitor.WhitelistChannels))
 	
 	defer func() {
 		if r := recover(); r != nil {
-			fmt.Printf("\n❌ 程序崩溃: %v\n", r)
+			logMain.Error("程序崩溃", "panic", r)
 		}
 	}()
 
-	fmt.Println("🚀 程序启动...")
-	fmt.Printf("📱 API ID: %d\n", ApiID)
-	fmt.Printf("🔑 API Hash: %s...\n", ApiHash[:10])
-	fmt.Printf("💾 会话文件: %s\n\n", SessionFile)
-
-	if ApiID == 0 || ApiHash == "" {
-		fmt.Println("❌ 错误: 请先配置 API ID 和 API Hash")
+	if s.ApiID == 0 || s.ApiHash == "" {
+		logMain.Error("请先配置 API ID 和 API Hash")
 		return
 	}
+	logMain.Info("程序启动", "api_id", s.ApiID, "session_file", s.SessionFile, "state_file", s.StateFile)
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
-	fmt.Printf("📡 Context 状态: %v\n\n", ctx.Err())
-
-	// 配置代理
-	proxyURL, err := url.Parse("socks5://" + ProxyAddr)
+	// 配置代理，每个代理的拨号都带日志和30秒超时
+	var dialCount int64
+	proxies, err := newProxyPool(s.ProxyURLs, s.ProxyStrategy, func(p *proxyConfig, dialer proxy.ContextDialer) dcs.DialFunc {
+		return func(ctx context.Context, network, address string) (net.Conn, error) {
+			n := atomic.AddInt64(&dialCount, 1)
+			logDial.Debug("正在连接", "dial", n, "network", network, "address", address, "proxy", p.String())
+			metricDials.WithLabelValues(dcLabel(address), p.String()).Inc()
+
+			// 为每个连接设置30秒超时
+			dialCtx, dialCancel := context.WithTimeout(ctx, 30*time.Second)
+			defer dialCancel()
+
+			conn, err := dialer.DialContext(dialCtx, network, address)
+			if err != nil {
+				logDial.Warn("连接失败", "dial", n, "address", address, "proxy", p.String(), "error", err)
+				metricDialFailures.WithLabelValues(dcLabel(address), p.String()).Inc()
+			} else {
+				logDial.Debug("连接成功", "dial", n, "address", address)
+			}
+			return conn, err
+		}
+	})
 	if err != nil {
-		fmt.Printf("❌ 代理地址解析失败: %v\n", err)
+		logProxy.Error("代理配置失败", "error", err)
 		return
 	}
 
-	dialer, err := proxy.FromURL(proxyURL, proxy.Direct)
-	if err != nil {
-		fmt.Printf("❌ 代理配置失败: %v\n", err)
-		return
+	logProxy.Info("使用代理", "proxy", proxies.Current().String())
+	if proxies.Len() > 1 {
+		logProxy.Info("启用代理池", "proxies", proxies.Len(), "strategy", proxies.strategy, "check_interval", s.ProxyCheckInterval)
+		go proxies.RunHealthCheck(ctx, s.ProxyCheckInterval)
 	}
 
-	fmt.Printf("🔌 使用代理: %s\n\n", ProxyAddr)
-
 	// 创建 Telegram 客户端
-	fmt.Println("🔧 创建 Telegram 客户端...")
 
 	// 先创建 dispatcher 和 gaps (按照官方示例)
 	dispatcher := tg.NewUpdateDispatcher()
@@ -174,7 +322,9 @@ func main() {
 
 	// 添加一个包装器来计数和调试
 	rawHandler := telegram.UpdateHandlerFunc(func(ctx context.Context, u tg.UpdatesClass) error {
-		updateCount++
+		count := atomic.AddInt64(&updateCount, 1)
+		metricUpdates.Inc()
+		health.touch()
 
 		// 只在有消息相关的更新时才打印
 		hasMessage := false
@@ -184,38 +334,220 @@ func main() {
 				switch upd.(type) {
 				case *tg.UpdateNewMessage, *tg.UpdateNewChannelMessage, *tg.UpdateEditMessage, *tg.UpdateEditChannelMessage:
 					hasMessage = true
-					dispatchCount++
+					atomic.AddInt64(&dispatchCount, 1)
 				}
 			}
 		case *tg.UpdateShortMessage, *tg.UpdateShortChatMessage:
 			hasMessage = true
-			dispatchCount++
+			atomic.AddInt64(&dispatchCount, 1)
 		}
 
-		// 只有包含消息时才打印
+		// 只有包含消息时才输出
 		if hasMessage {
-			fmt.Printf("\n[%s] 收到消息更新 (#%d)\n", time.Now().Format("15:04:05"), updateCount)
+			logUpdates.Debug("收到消息更新", "update", count)
 		}
 
 		// 传递给 dispatcher 处理
 		err := dispatcher.Handle(ctx, u)
 		if err != nil && hasMessage {
-			fmt.Printf("  ⚠️ 处理错误: %v\n", err)
+			logUpdates.Warn("处理更新出错", "update", count, "error", err)
 		}
 		return err
 	})
 
+	// 链接记录，用于比较编辑前后的链接
+	links, err := store.NewLinkStore(s.StoreFile, s.StoreRetention)
+	if err != nil {
+		logMain.Error("初始化失败", "error", err)
+		return
+	}
+
+	// 订阅 API 客户端，默认直连，按配置决定是否走代理
+	subscriptionClient := &http.Client{Timeout: 10 * time.Second}
+	if s.SubscriptionAPIUseProxy {
+		subscriptionClient = proxies.HTTPClient(10 * time.Second)
+		logSink.Info("订阅 API 使用代理")
+	}
+
+	// 按配置创建过滤链，各个更新处理器共用
+	l := newListener(configFile, cfg, s, links, newSubscriptionSink(s, subscriptionClient, links))
+
+	// 消息归档
+	if s.ArchiveEnabled {
+		l.archive, err = store.OpenArchive(s.ArchiveFile, s.ArchiveRetention)
+		if err != nil {
+			logMain.Error("初始化失败", "error", err)
+			return
+		}
+		defer l.archive.Close()
+		logStore.Info("消息归档已开启", "file", s.ArchiveFile)
+	}
+
+	// 匹配消息转发
+	if s.ForwardEnabled {
+		l.forwards, err = newForwarder(s.ForwardTarget, s.ForwardMode, s.ForwardTemplate, s.ForwardRate, s.ChannelOptions)
+		if err != nil {
+			logMain.Error("初始化失败", "error", err)
+			return
+		}
+		l.forwards.dryRun = s.ForwardDryRun
+		go l.forwards.Run(ctx)
+		logSink.Info("匹配消息转发已开启", "target", s.ForwardTarget, "mode", l.forwards.mode, "per_minute", int(time.Minute/l.forwards.interval), "dry_run", s.ForwardDryRun)
+	}
+
+	// 相册合并
+	if s.AlbumWindow > 0 {
+		l.albums = newAlbumBuffer(s.AlbumWindow)
+		go l.albums.Run(ctx)
+	}
+
+	// 订阅结果通知
+	if s.NotifyEnabled {
+		l.notices, err = newNotifier(s.NotifyTarget, s.NotifyLinkResults, s.NotifyDigest, s.NotifyFailureThreshold)
+		if err != nil {
+			logMain.Error("初始化失败", "error", err)
+			return
+		}
+		l.notices.dryRun = s.NotifyDryRun
+		go l.notices.Run(ctx)
+		logSink.Info("订阅结果通知已开启", "target", s.NotifyTarget, "dry_run", s.NotifyDryRun)
+	}
+	registerQueueMetrics(l)
+
+	// dry-run 模式
+	for sink, dryRun := range map[string]bool{"subscription": s.SubscriptionAPIDryRun, "forward": s.ForwardDryRun, "notify": s.NotifyDryRun} {
+		if dryRun {
+			metricDryRun.WithLabelValues(sink).Set(1)
+		}
+	}
+	if s.SubscriptionAPIDryRun {
+		logSink.Warn("[dry-run] 订阅 API 不会收到任何请求，链接只记录日志", "dry_run", true)
+	}
+
+	// 控制命令
+	if s.ControlEnabled {
+		l.commands = newController(l, s.ControlChat, proxies)
+		logControl.Info("控制命令已开启", "chat", s.ControlChat)
+	}
+
+	// 本地管理 API，未设置 token 时不启动
+	if s.AdminEnabled {
+		if s.AdminToken == "" {
+			logHTTP.Warn("管理 API 未设置 token，不启动")
+		} else {
+			go runHTTPServer(ctx, "管理 API", s.AdminListen, newAdminServer(l, s.AdminToken))
+		}
+	}
+
+	// Prometheus 指标和健康检查，监听地址相同时共用一个服务
+	monitoring := make(map[string]*http.ServeMux)
+	muxFor := func(addr string) *http.ServeMux {
+		if monitoring[addr] == nil {
+			monitoring[addr] = http.NewServeMux()
+		}
+		return monitoring[addr]
+	}
+	if s.MetricsEnabled {
+		muxFor(s.MetricsListen).Handle("/metrics", promhttp.Handler())
+	}
+	if s.HealthEnabled {
+		h := healthHandler(s.HealthReadyTimeout, s.HealthUpdateWindow)
+		muxFor(s.HealthListen).Handle("/healthz", h)
+		muxFor(s.HealthListen).Handle("/readyz", h)
+	}
+	for addr, mux := range monitoring {
+		go runHTTPServer(ctx, "监控服务", addr, mux)
+	}
+
+	// updates 状态持久化到文件，重启后通过 getDifference 补齐停机期间的消息
+	stateStorage, err := newFileStateStorage(s.StateFile)
+	if err != nil {
+		logMain.Error("初始化失败", "error", err)
+		return
+	}
+
+	accessHasher = stateStorage
+	go stateStorage.Run(ctx)
+	// 退出前写入最新的 updates 状态，下次启动时不会重复处理已处理的更新
+	defer func() {
+		if err := stateStorage.Flush(); err != nil {
+			logUpdates.Error("保存 updates 状态失败", "error", err)
+		}
+	}()
+
 	gaps := updates.New(updates.Config{
-		Handler: rawHandler,
+		Handler:      rawHandler,
+		Storage:      stateStorage,
+		AccessHasher: stateStorage,
+		Logger:       gotdLogger.Named("gaps"),
+		OnChannelTooLong: func(channelID int64) {
+			logUpdates.Warn("频道缺失的消息过多，无法完整补齐，建议开启历史消息获取", "channel", channelID)
+		},
 	})
 
 	// 注册消息处理器
+	l.registerHandlers(dispatcher)
+
+	// 监督循环：client.Run 出错后按指数退避重连
+	// gaps 在多次运行之间复用，重连后从保存的 updates 状态补齐缺失的消息
+	backoff := newReconnectBackoff(s.ReconnectInitialDelay, s.ReconnectMaxDelay)
+	historyFetched := false
+	for attempt := 1; ; attempt++ {
+		startedAt := time.Now()
+		runErr := runClient(ctx, l, gaps, proxies, &dialCount, &dispatchCount, !historyFetched, func() {
+			historyFetched = true
+		})
+		gaps.Reset() // 下次运行重新加载保存的状态
+
+		logMain.Info("client.Run 完成", "error", runErr)
+		if ctx.Err() != nil {
+			break
+		}
+		if runErr == nil {
+			break
+		}
+
+		// 会话失效，备份会话文件后重新登录
+		if tgclient.NeedRelogin(runErr) {
+			logAuth.Warn("会话已失效，需要重新登录", "error", runErr)
+			backup, err := tgclient.BackupSession(s.SessionFile)
+			if err != nil {
+				logAuth.Error("备份会话文件失败", "error", err)
+				return
+			}
+			if backup != "" {
+				logAuth.Info("已备份失效的会话文件", "backup", backup)
+			}
+			backoff.Reset()
+			continue
+		}
+
+		// 稳定运行过一段时间说明不是持续性故障，重置退避时间
+		if time.Since(startedAt) > s.ReconnectMaxDelay {
+			backoff.Reset()
+		}
+		delay := backoff.Next()
+		logMain.Warn("运行失败，稍后重连", "attempt", attempt, "delay", delay)
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	logMain.Info("程序正常退出")
+}
+
+// registerHandlers 在 dispatcher 上注册新消息、编辑、删除和频道状态的处理器
+func (l *listener) registerHandlers(dispatcher tg.UpdateDispatcher) {
 	dispatcher.OnNewMessage(func(ctx context.Context, e tg.Entities, update *tg.UpdateNewMessage) error {
 		msg, ok := update.Message.(*tg.Message)
 		if !ok {
 			return nil
 		}
-		return handleMessage(msg, e)
+		return l.handleMessage(ctx, msg, e)
 	})
 
 	dispatcher.OnNewChannelMessage(func(ctx context.Context, e tg.Entities, update *tg.UpdateNewChannelMessage) error {
@@ -223,61 +555,48 @@ func main() {
 		if !ok {
 			return nil
 		}
-		return handleMessage(msg, e)
+		return l.handleMessage(ctx, msg, e)
 	})
 
-	// 添加编辑消息处理器
+	// 消息删除和频道状态变化
+	dispatcher.OnDeleteChannelMessages(l.handleDeleteChannelMessages)
+	dispatcher.OnChannel(l.handleChannelUpdate)
+
+	// 添加编辑消息处理器，只处理编辑中新增的链接
 	dispatcher.OnEditMessage(func(ctx context.Context, e tg.Entities, update *tg.UpdateEditMessage) error {
 		if msg, ok := update.Message.(*tg.Message); ok {
-			return handleMessage(msg, e)
+			return l.handleEdit(ctx, msg, e)
 		}
 		return nil
 	})
 
 	dispatcher.OnEditChannelMessage(func(ctx context.Context, e tg.Entities, update *tg.UpdateEditChannelMessage) error {
 		if msg, ok := update.Message.(*tg.Message); ok {
-			return handleMessage(msg, e)
+			return l.handleEdit(ctx, msg, e)
 		}
 		return nil
 	})
+}
 
+// runClient 创建 Telegram 客户端并运行一次，直到连接断开或 ctx 结束
+// fetchHistory 为 true 时在登录后获取历史消息，成功后调用 onHistoryFetched
+func runClient(ctx context.Context, l *listener, gaps *updates.Manager, proxies *proxyPool, dialCount, dispatchCount *int64, fetchHistory bool, onHistoryFetched func()) error {
 	// 使用带信号监听的原始 ctx,不添加超时限制
-	var dialCount int
-	client := telegram.NewClient(ApiID, ApiHash, telegram.Options{
-		SessionStorage: &telegram.FileSessionStorage{Path: SessionFile},
-		DialTimeout:    30 * time.Second, // 每个连接30秒超时
-		UpdateHandler:  gaps,             // 设置 gaps 为更新处理器
-		Middlewares: []telegram.Middleware{
-			updhook.UpdateHook(gaps.Handle), // 关键：添加 UpdateHook 中间件
-		},
-		Resolver: dcs.Plain(dcs.PlainOptions{
-			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
-				dialCount++
-				fmt.Printf("🔗 [#%d] 正在连接: %s %s\n", dialCount, network, address)
-
-				// 为每个连接设置30秒超时
-				dialCtx, dialCancel := context.WithTimeout(ctx, 30*time.Second)
-				defer dialCancel()
-
-				conn, err := dialer.(proxy.ContextDialer).DialContext(dialCtx, network, address)
-				if err != nil {
-					fmt.Printf("❌ [#%d] 连接失败: %v\n", dialCount, err)
-				} else {
-					fmt.Printf("✅ [#%d] 连接成功: %s\n", dialCount, address)
-				}
-				return conn, err
-			},
-		}),
+	client := tgclient.New(tgclient.Options{
+		AppID:       l.settings.ApiID,
+		AppHash:     l.settings.ApiHash,
+		SessionFile: l.settings.SessionFile,
+		Gaps:        gaps,
+		Resolver:    proxies, // 代理池，连接失败时自动切换代理
+		Logger:      gotdLogger,
 	})
 
 	// 运行客户端
-	fmt.Println("🔌 连接到 Telegram 服务器...")
-	fmt.Println("⏰ 开始执行 client.Run...")
-	fmt.Println("💡 提示: 如果长时间卡在连接,可以:")
-	fmt.Println("   1. 删除 session.json 重新登录")
-	fmt.Println("   2. 检查代理是否稳定")
-	fmt.Println("   3. 尝试禁用 IPv6")
-	fmt.Println()
+	logMain.Info("连接到 Telegram 服务器")
+
+	// 长时间无进展时中断本次运行，由监督循环重连
+	runCtx, runCancel := context.WithCancelCause(ctx)
+	defer runCancel(nil)
 
 	// 添加一个 goroutine 监控连接进度
 	progressDone := make(chan struct{})
@@ -285,66 +604,72 @@ func main() {
 		ticker := time.NewTicker(5 * time.Second)
 		defer ticker.Stop()
 		startTime := time.Now()
-		lastDialCount := 0
+		var lastDialCount int64
 		noProgressCount := 0
 		for {
 			select {
 			case <-progressDone:
 				return
+			case <-runCtx.Done():
+				return
 			case <-ticker.C:
 				elapsed := time.Since(startTime).Round(time.Second)
-				fmt.Printf("⏳ [%s] 等待回调中... (已用时: %v, 连接次数: %d)\n",
-					time.Now().Format("15:04:05"), elapsed, dialCount)
+				dials := atomic.LoadInt64(dialCount)
+				logDial.Info("等待回调中", "elapsed", elapsed, "dials", dials)
 
 				// 检测是否有进展
-				if dialCount == lastDialCount {
+				if dials == lastDialCount {
 					noProgressCount++
-					if noProgressCount >= 6 { // 30秒无进展
-						fmt.Println("⚠️ 30秒无进展,建议:")
-						fmt.Println("   - 按 Ctrl+C 停止程序")
-						fmt.Println("   - 删除 session.json 文件")
-						fmt.Println("   - 重新运行程序")
+					if time.Duration(noProgressCount)*5*time.Second >= l.settings.StallTimeout {
+						logDial.Warn("连接无进展，断开重连", "timeout", l.settings.StallTimeout)
+						runCancel(errStalled)
+						return
 					}
 				} else {
 					noProgressCount = 0
 				}
-				lastDialCount = dialCount
+				lastDialCount = dials
 			}
 		}
 	}()
 
-	runErr := client.Run(ctx, func(ctx context.Context) error {
+	err := client.Run(runCtx, func(ctx context.Context) error {
 		close(progressDone) // 停止进度监控
-		fmt.Printf("\n✨ [%s] 回调函数被调用！\n", time.Now().Format("15:04:05"))
-		fmt.Println("🔐 开始认证流程...")
+		health.setConnected()
+		logAuth.Info("已连接，开始认证")
 		// 登录
-		if err := authenticate(ctx, client); err != nil {
-			fmt.Printf("❌ 认证失败: %v\n", err)
+		if err := tgclient.Authenticate(ctx, client); err != nil {
+			logAuth.Error("认证失败", "error", err)
 			return err
 		}
 
-		fmt.Println("✅ 登录成功！")
+		logAuth.Info("登录成功")
+		health.setAuthorized()
 
 		// 获取当前用户信息
 		api := client.API()
-		self, err := api.UsersGetUsers(ctx, []tg.InputUserClass{&tg.InputUserSelf{}})
+		tgAPI.Store(api)
+		user, err := tgclient.Self(ctx, api)
 		if err != nil {
-			fmt.Printf("❌ 获取用户信息失败: %v\n", err)
+			logAuth.Error("获取用户信息失败", "error", err)
 			return err
 		}
 
-		user := self[0].(*tg.User)
-		fmt.Printf("👤 当前用户: %s %s (ID: %d)\n", user.FirstName, user.LastName, user.ID)
-		fmt.Printf("📋 监听关键词: %v\n", Keywords)
-		if len(MonitorChannels) > 0 {
-			fmt.Printf("🎯 监听频道: %v\n", MonitorChannels)
+		selfID.Store(user.ID)
+		metricConnected.Set(1)
+		defer metricConnected.Set(0)
+		logAuth.Info("当前用户", "name", strings.TrimSpace(user.FirstName+" "+user.LastName), "id", user.ID)
+		monitorChannels, keywords := l.monitorChannels(), l.pipeline.Config().Keywords
+		if len(monitorChannels) > 0 {
+			logFilter.Info("监听指定频道", "channels", monitorChannels, "keywords", keywords)
 		} else {
-			fmt.Println("🌐 监听所有频道")
+			logFilter.Info("监听所有频道", "keywords", keywords)
 		}
-		fmt.Println()
+
+		// 解析讨论组和论坛话题配置
+		resolveChannelOptions(ctx, api, user.ID, l.settings.ChannelOptions)
 
 		// 获取对话列表来验证连接
-		fmt.Println("📝 获取对话列表...")
 		dialogs, err := api.MessagesGetDialogs(ctx, &tg.MessagesGetDialogsRequest{
 			OffsetDate: 0,
 			OffsetID:   0,
@@ -353,36 +678,31 @@ func main() {
 			Hash:       0,
 		})
 		if err != nil {
-			fmt.Printf("⚠️ 获取对话列表失败: %v\n", err)
+			logUpdates.Warn("获取对话列表失败", "error", err)
 		} else {
 			switch d := dialogs.(type) {
 			case *tg.MessagesDialogs:
-				fmt.Printf("✅ 找到 %d 个对话\n", len(d.Dialogs))
+				logUpdates.Info("获取对话列表成功", "dialogs", len(d.Dialogs))
 			case *tg.MessagesDialogsSlice:
-				fmt.Printf("✅ 找到 %d 个对话 (总共 %d 个)\n", len(d.Dialogs), d.Count)
+				logUpdates.Info("获取对话列表成功", "dialogs", len(d.Dialogs), "total", d.Count)
 			}
 		}
-		fmt.Println()
 
 		// 获取指定频道的历史消息（可通过 FetchHistoryEnabled 开关控制）
-		if FetchHistoryEnabled && len(MonitorChannels) > 0 {
-			fmt.Println("📜 开始获取历史消息...")
-			for _, channelID := range MonitorChannels {
-				if err := fetchChannelHistory(ctx, api, channelID); err != nil {
-					fmt.Printf("⚠️ 获取频道 %d 历史消息失败: %v\n", channelID, err)
+		// 重连时不再重复获取，缺失的消息由 gaps 补齐
+		if fetchHistory && l.settings.FetchHistoryEnabled && len(monitorChannels) > 0 {
+			logFilter.Info("开始获取历史消息")
+			for _, channelID := range monitorChannels {
+				if _, err := l.fetchChannelHistory(ctx, api, user.ID, channelID, 100); err != nil {
+					logFilter.Warn("获取历史消息失败", "channel", channelID, "error", err)
 				}
 			}
-			fmt.Println("✅ 历史消息获取完成")
-			fmt.Println()
+			logFilter.Info("历史消息获取完成")
 		}
+		onHistoryFetched()
 
 		// 启动监听
-		fmt.Println("👂 开始监听实时消息...")
-		fmt.Println("⏳ 等待新消息中...")
-		fmt.Println("💡 提示: 程序会显示已加入的频道/群组的新消息")
-		fmt.Println("📌 注意: 可能会先收到最近的几条历史消息,然后等待新消息")
-		fmt.Println("🔄 测试方法: 向任何已加入的频道/群组发送消息,或等待其他人发送")
-		fmt.Println()
+		logUpdates.Info("开始监听实时消息")
 
 		// 启动心跳检测
 		go func() {
@@ -395,559 +715,348 @@ func main() {
 					return
 				case <-ticker.C:
 					uptime := time.Since(startTime).Round(time.Second)
-					fmt.Printf("[%s] 运行:%v | 消息:%d\n",
-						time.Now().Format("15:04:05"), uptime, dispatchCount)
+					logMain.Info("心跳", "uptime", uptime, "messages", atomic.LoadInt64(dispatchCount), "proxy", proxies.Current().String())
+					if proxies.Len() > 1 {
+						for _, line := range proxies.Status() {
+							logProxy.Debug("代理状态", "status", line)
+						}
+					}
 				}
 			}
 		}()
 
 		// 使用正确的用户ID - 按照官方示例运行 gaps.Run
-		fmt.Printf("\n🚀 启动 gaps.Run (UserID: %d, IsBot: %v)\n", user.ID, user.Bot)
+		logUpdates.Info("启动 gaps", "user_id", user.ID, "bot", user.Bot)
 
 		// 按照官方示例的方式运行 gaps
 		return gaps.Run(ctx, api, user.ID, updates.AuthOptions{
 			IsBot: user.Bot,
 			OnStart: func(ctx context.Context) {
-				fmt.Println("✅ Gaps started - 开始接收实时更新")
+				logUpdates.Info("gaps 已启动，开始接收实时更新")
+				health.setGapsStarted()
 			},
 		})
 	})
 
-	fmt.Printf("🏁 client.Run 完成，错误: %v\n", runErr)
-	if runErr != nil {
-		fmt.Printf("❌ 详细错误: %v\n", runErr)
-		return
-	}
-
-	fmt.Println("\n👋 程序正常退出")
-}
+	health.reset()
 
-// handleMessage 处理消息并检查关键词
-func handleMessage(msg *tg.Message, e tg.Entities) error {
-	messageText := msg.Message
-
-	// ✅ 频道过滤检查
-	var channelID int64
-	if msg.PeerID != nil {
-		if peer, ok := msg.PeerID.(*tg.PeerChannel); ok {
-			channelID = peer.ChannelID
-		}
+	// 被进度监控中断时返回明确的错误，而不是 context canceled
+	if cause := context.Cause(runCtx); errors.Is(cause, errStalled) && ctx.Err() == nil {
+		return errStalled
 	}
+	return err
+}
 
-	// 如果配置了监听频道列表,则只处理这些频道的消息
-	if len(MonitorChannels) > 0 {
-		allowedChannel := false
-		for _, id := range MonitorChannels {
-			if id == channelID {
-				allowedChannel = true
-				break
-			}
-		}
-		// 不在监听列表中的频道,直接跳过
-		if !allowedChannel {
-			return nil
-		}
+// handleMessage 处理实时消息
+func (l *listener) handleMessage(ctx context.Context, msg *tg.Message, e tg.Entities) error {
+	// 控制命令不参与过滤
+	if l.commands != nil && l.commands.Handle(ctx, msg) {
+		return nil
 	}
-
-	// ✅ 启用关键词匹配功能
-	matched := false
-	for _, keyword := range Keywords {
-		if strings.Contains(strings.ToLower(messageText), strings.ToLower(keyword)) {
-			matched = true
-			break
-		}
+	if l.paused.Load() {
+		return nil
 	}
 
-	// 如果没有匹配关键词,直接跳过
-	if !matched {
+	// 相册的各条消息先暂存，合并后作为整体过滤
+	if msg.GroupedID != 0 && l.albums != nil {
+		l.albums.Add(msg, func(ctx context.Context, messages []*tg.Message) {
+			l.processMessages(ctx, messages, e.Users, time.Now().Format("15:04:05"))
+		})
 		return nil
 	}
 
-	// ✅ 检查是否在白名单中
-	isWhitelisted := false
-	for _, whiteID := range WhitelistChannels {
-		if whiteID == channelID {
-			isWhitelisted = true
-			break
-		}
+	l.processMessages(ctx, []*tg.Message{msg}, e.Users, time.Now().Format("15:04:05"))
+	return nil
+}
+
+// processMessages 对一条消息或一个相册执行过滤链，提取链接并提交订阅
+// 相册中各条消息的文本合并后一起过滤，users 用于获取发送者信息
+// timeLabel 为输出中显示的时间，返回是否提取到链接
+func (l *listener) processMessages(ctx context.Context, messages []*tg.Message, users map[int64]*tg.User, timeLabel string) bool {
+	src, messageText, links, verdict := l.filterMessages(ctx, messages, users)
+	if !verdict.Matched() {
+		l.archiveMessages(src, messages, messageText, verdict, nil)
+		return false
 	}
 
-	// 如果不在白名单中,需要进行二次过滤
-	if !isWhitelisted {
-		// ✅ 消息内容二次过滤 - 检查是否包含“投稿”或“订阅”
-		contentMatched := false
-		for _, filterWord := range ContentFilter {
-			if strings.Contains(messageText, filterWord) {
-				contentMatched = true
-				break
-			}
+	// 记录消息和链接，消息被编辑时用于比较新旧链接
+	record := &store.MessageRecord{
+		PeerID:    src.PeerID,
+		ChannelID: src.ChannelID,
+		Source:    src.Label(),
+		Date:      messages[0].Date,
+	}
+	for _, m := range messages {
+		record.MessageIDs = append(record.MessageIDs, m.ID)
+		if m.EditDate > record.EditDate {
+			record.EditDate = m.EditDate
 		}
-
-		// 如果消息不包含指定关键字,直接跳过
-		if !contentMatched {
-			return nil
+		if len(messages) > 1 {
+			record.Texts = append(record.Texts, m.Message)
 		}
 	}
-	// 提取消息中的链接
-	links := extractLinks(messageText)
-
-	// 只显示提取到的链接
-	if len(links) > 0 {
-		// 获取来源类型
-		var source string
-		if msg.PeerID != nil {
-			switch peer := msg.PeerID.(type) {
-			case *tg.PeerChannel:
-				source = fmt.Sprintf("频道:%d", peer.ChannelID)
-			case *tg.PeerChat:
-				source = fmt.Sprintf("群组:%d", peer.ChatID)
-			case *tg.PeerUser:
-				source = fmt.Sprintf("私聊:%d", peer.UserID)
-			}
-		}
+	record.Origin = src.OriginLabel()
+	record.Links = l.submitLinks(ctx, src, timeLabel, links)
+	l.saveRecord(record)
+	l.archiveMessages(src, messages, messageText, verdict, record.Links)
+
+	// 转发到审核频道
+	if l.forwards != nil {
+		l.forwards.Enqueue(messages, users, src, messageText, links)
+	}
+	return true
+}
 
-		// 单行显示: [时间] 来源 | 链接
-		for _, link := range links {
-			fmt.Printf("[%s] %s | %s\n",
-				time.Now().Format("15:04:05"),
-				source,
-				link)
+// filterMessages 执行过滤链，返回消息来源、合并后的消息内容、通过过滤的链接和过滤结果
+// 消息在频道或话题检查阶段被跳过时内容为空
+func (l *listener) filterMessages(ctx context.Context, messages []*tg.Message, users map[int64]*tg.User) (src messageSource, messageText string, links []string, verdict filter.Verdict) {
+	msg := messages[0]
+	defer func() {
+		recordTrace(src, messages, messageText, verdict)
+	}()
 
-			// 🔥 自动添加订阅链接
-			success, message := addSubscription(link)
-			if success {
-				fmt.Printf("  ✅ 订阅添加成功: %s\n", message)
-			} else {
-				if message == "订阅已存在" {
-					fmt.Printf("  ⚠️  订阅已存在，跳过\n")
-				} else {
-					fmt.Printf("  ❌ 订阅添加失败: %s\n", message)
-				}
-			}
-		}
+	// ✅ 解析消息来源（频道、讨论组评论、论坛话题）
+	src, ok := resolveSource(msg)
+	if !ok {
+		// 频道帖子在讨论组中的自动转发副本，频道中已经处理过
+		verdict.Record("source", false, "讨论组中的频道帖子副本，已在频道中处理")
+		verdict.Outcome = filter.Skipped
+		return src, "", nil, verdict
 	}
+	verdict.Record("source", true, "%s", src.Label())
 
-	return nil
-} // 认证登录
-func authenticate(ctx context.Context, client *telegram.Client) error {
-	return client.Auth().IfNecessary(
-		ctx,
-		auth.NewFlow(
-			&terminalAuth{},
-			auth.SendCodeOptions{},
-		),
-	)
-}
+	// ✅ 自己发送的消息、转发目标和控制对话中的消息
+	if reason := l.ownMessage(msg); reason != "" {
+		verdict.Record("self", false, "%s", reason)
+		verdict.Outcome = filter.Skipped
+		return src, "", nil, verdict
+	}
+	src.setSender(msg, users)
+	channelID := src.ChannelID
+
+	// 只为监听的频道记录按频道的指标，其他频道的消息归入 other，避免标签数量无限增长
+	monitorChannels := l.monitorChannels()
+	monitored := len(monitorChannels) == 0 || slices.Contains(monitorChannels, channelID)
+	if monitored {
+		registry.touch(channelID, msg.Date)
+		metricMessages.WithLabelValues(channelLabel(channelID)).Inc()
+		metricLastUpdate.WithLabelValues(channelLabel(channelID)).Set(float64(msg.Date))
+	} else {
+		metricMessages.WithLabelValues(otherChannelLabel).Inc()
+	}
 
-// terminalAuth 终端认证器
-type terminalAuth struct{}
+	// ✅ 忽略来自指定频道的转发
+	if src.Forwarded && src.OriginChannelID != 0 {
+		if slices.Contains(l.settings.IgnoreForwardsFrom, src.OriginChannelID) {
+			verdict.Record("ignore_forwards", false, "转发自忽略的频道 %d", src.OriginChannelID)
+			verdict.Outcome = filter.Skipped
+			return src, "", nil, verdict
+		}
+		verdict.Record("ignore_forwards", true, "转发自频道 %d，不在忽略列表中", src.OriginChannelID)
+	}
 
-func (terminalAuth) Phone(_ context.Context) (string, error) {
-	fmt.Print("请输入手机号（国际格式，如 +8613800138000）: ")
-	phone, err := bufio.NewReader(os.Stdin).ReadString('\n')
-	if err != nil {
-		fmt.Printf("❌ 读取手机号失败: %v\n", err)
-		return "", err
+	// 如果配置了监听频道列表,则只处理这些频道的消息
+	if len(monitorChannels) > 0 {
+		// 不在监听列表中的频道,直接跳过
+		if !monitored {
+			verdict.Record("channel", false, "频道 %d 不在监听列表中", channelID)
+			verdict.Outcome = filter.Skipped
+			return src, "", nil, verdict
+		}
+		verdict.Record("channel", true, "频道 %d 在监听列表中", channelID)
+	} else {
+		verdict.Record("channel", true, "监听所有频道")
 	}
-	phone = strings.TrimSpace(phone)
-	fmt.Printf("📞 使用手机号: %s\n", phone)
-	return phone, nil
-}
 
-func (terminalAuth) Password(_ context.Context) (string, error) {
-	fmt.Print("请输入密码（如果启用了两步验证）: ")
-	pwd, err := bufio.NewReader(os.Stdin).ReadString('\n')
-	if err != nil {
-		fmt.Printf("❌ 读取密码失败: %v\n", err)
-		return "", err
+	// ✅ 论坛话题过滤
+	if !registry.topicAllowed(src.PeerID, src.TopicID) {
+		verdict.Record("topic", false, "话题 %d 不在监听的话题中", src.TopicID)
+		verdict.Outcome = filter.Skipped
+		return src, "", nil, verdict
+	}
+	if src.TopicID != 0 {
+		verdict.Record("topic", true, "话题 %d", src.TopicID)
 	}
-	return strings.TrimSpace(pwd), nil
-}
 
-func (terminalAuth) Code(_ context.Context, _ *tg.AuthSentCode) (string, error) {
-	fmt.Print("请输入收到的验证码: ")
-	code, err := bufio.NewReader(os.Stdin).ReadString('\n')
-	return strings.TrimSpace(code), err
-}
+	// ✅ 发送者过滤（群组中的用户白名单、黑名单、仅管理员、机器人）
+	allowed, reason := l.senderDecision(ctx, src)
+	verdict.Record("sender", allowed, "%s", reason)
+	if !allowed {
+		verdict.Outcome = filter.Skipped
+		return src, "", nil, verdict
+	}
 
-func (terminalAuth) AcceptTermsOfService(_ context.Context, tos tg.HelpTermsOfService) error {
-	return nil
+	// 消息文本加上网页预览、投票、文件中的内容
+	var contents []string
+	for _, m := range messages {
+		contents = append(contents, messageContent(ctx, m, l.settings.Documents))
+	}
+	messageText = strings.Join(contents, "\n")
+
+	// ✅ 关键词、二次过滤（白名单频道跳过）、链接黑名单
+	found, links := l.pipeline.Filter(&verdict, filterMessage(src, messageText))
+	metricLinks.WithLabelValues("extracted").Add(float64(len(found)))
+	metricLinks.WithLabelValues(store.Blacklisted).Add(float64(len(found) - len(links)))
+	if verdict.Matched() {
+		metricMatches.WithLabelValues(channelLabel(channelID)).Inc()
+	}
+	return src, messageText, links, verdict
 }
 
-func (terminalAuth) SignUp(_ context.Context) (auth.UserInfo, error) {
-	return auth.UserInfo{}, fmt.Errorf("需要注册")
+// filterMessage 返回交给过滤链的消息内容
+func filterMessage(src messageSource, text string) filter.Message {
+	m := filter.Message{
+		Text:      text,
+		ChannelID: src.ChannelID,
+		Source:    src.Label(),
+		Origin:    src.OriginLabel(),
+	}
+	if src.Forwarded {
+		m.OriginChannelID = src.OriginChannelID
+	}
+	return m
 }
 
-// extractLinks 从文本中提取所有链接，并过滤黑名单关键字
-func extractLinks(text string) []string {
-	var links []string
-	lines := strings.Split(text, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		// 查找包含 http:// 或 https:// 的行
-		if strings.Contains(line, "http://") || strings.Contains(line, "https://") {
-			// 循环提取当前行中的所有链接
-			remainingLine := line
-			for len(remainingLine) > 0 {
-				// 查找 http:// 或 https:// 的位置
-				httpIdx := strings.Index(remainingLine, "http://")
-				httpsIdx := strings.Index(remainingLine, "https://")
-
-				startIdx := -1
-				if httpIdx >= 0 && httpsIdx >= 0 {
-					startIdx = min(httpIdx, httpsIdx)
-				} else if httpIdx >= 0 {
-					startIdx = httpIdx
-				} else if httpsIdx >= 0 {
-					startIdx = httpsIdx
-				}
-
-				// 如果没有找到链接，退出循环
-				if startIdx < 0 {
-					break
-				}
-
-				// 从 http/https 开始提取，直到遇到空格、换行或其他分隔符
-				linkStart := startIdx
-				linkEnd := linkStart
-				for linkEnd < len(remainingLine) {
-					ch := remainingLine[linkEnd]
-					// 遇到空格、换行、中文符号等结束
-					if ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' {
-						break
-					}
-					linkEnd++
-				}
-
-				link := remainingLine[linkStart:linkEnd]
-				// 清理可能的尾部标点符号（包括中文和英文标点）
-				link = strings.TrimRight(link, ",.;!?，。；！？、")
-
-				// 检查链接是否包含黑名单关键字
-				isBlacklisted := false
-				linkLower := strings.ToLower(link)
-				for _, blackword := range LinkBlacklist {
-					if strings.Contains(linkLower, strings.ToLower(blackword)) {
-						isBlacklisted = true
-						break
-					}
-				}
+// submitLinks 输出并通过过滤链提交链接，返回每个链接的处理结果
+func (l *listener) submitLinks(ctx context.Context, src messageSource, timeLabel string, links []string) []*store.LinkRecord {
+	var records []*store.LinkRecord
 
-				// 只添加不在黑名单中的链接
-				if !isBlacklisted && len(link) > 8 { // 至少要有 https:// 的长度
-					links = append(links, link)
-				}
+	// 来源中显示转发消息的原始来源和发送者
+	source := src.Label()
+	if origin := src.OriginLabel(); origin != "" {
+		source += " ← " + origin
+	}
+	if sender := src.SenderLabel(); sender != "" {
+		source += " 👤 " + sender
+	}
+	// dry-run 模式下的日志都带上 dry_run=true
+	log := logSink
+	if l.settings.SubscriptionAPIDryRun {
+		log = logSink.With("dry_run", true)
+	}
+	for _, link := range links {
+		log.Info("发现订阅链接", "time", timeLabel, "source", source, "link", link)
+	}
 
-				// 继续处理剩余部分
-				remainingLine = remainingLine[linkEnd:]
-			}
+	// 🔥 自动添加订阅链接
+	for _, r := range l.pipeline.Submit(ctx, filterMessage(src, ""), links) {
+		metricLinks.WithLabelValues(r.Status).Inc()
+		switch r.Status {
+		case store.Submitted:
+			log.Info("订阅添加成功", "link", r.URL, "message", r.Message)
+		case store.Duplicate:
+			log.Info("订阅已存在，跳过", "link", r.URL, "message", r.Message)
+		case store.DryRun:
+			log.Info("[dry-run] 订阅未提交", "link", r.URL)
+		default:
+			log.Warn("订阅添加失败", "link", r.URL, "message", r.Message)
 		}
+		records = append(records, &store.LinkRecord{URL: r.URL, Status: r.Status, Message: r.Message, Time: time.Now()})
 	}
-	return links
-}
 
-// min 返回两个整数中较小的一个
-func min(a, b int) int {
-	if a < b {
-		return a
+	if l.notices != nil {
+		l.notices.LinkResults(src.Label(), source, records)
 	}
-	return b
+	return records
 }
 
-// fetchChannelHistory 获取指定频道的历史消息
-func fetchChannelHistory(ctx context.Context, api *tg.Client, channelID int64) error {
-	fmt.Printf("\n📥 正在获取频道 %d 的历史消息...\n", channelID)
-
-	// 构造 InputPeerChannel
-	inputPeer := &tg.InputPeerChannel{
-		ChannelID:  channelID,
-		AccessHash: 0, // 通常需要从之前的请求中获取
-	}
-
-	// 尝试通过 InputChannel 获取消息
-	// 如果 AccessHash 未知，尝试先解析频道
-	channel, err := api.ChannelsGetChannels(ctx, []tg.InputChannelClass{
-		&tg.InputChannel{
-			ChannelID:  channelID,
-			AccessHash: 0,
-		},
-	})
+// fetchChannelHistory 获取指定频道最近 limit 条历史消息（最多 100 条），返回匹配的消息数
+func (l *listener) fetchChannelHistory(ctx context.Context, api *tg.Client, userID, channelID int64, limit int) (int, error) {
 
+	channel, err := resolveChannel(ctx, api, userID, channelID)
 	if err != nil {
-		// 如果失败，尝试从对话中查找 AccessHash
-		dialogs, err := api.MessagesGetDialogs(ctx, &tg.MessagesGetDialogsRequest{
-			OffsetDate: 0,
-			OffsetID:   0,
-			OffsetPeer: &tg.InputPeerEmpty{},
-			Limit:      100,
-			Hash:       0,
-		})
-
-		if err != nil {
-			return fmt.Errorf("获取对话列表失败: %w", err)
-		}
-
-		// 查找对应的频道
-		var accessHash int64
-		var foundChannel *tg.Channel
-		switch d := dialogs.(type) {
-		case *tg.MessagesDialogs:
-			for _, chat := range d.Chats {
-				if ch, ok := chat.(*tg.Channel); ok && ch.ID == channelID {
-					accessHash = ch.AccessHash
-					foundChannel = ch
-					break
-				}
-			}
-		case *tg.MessagesDialogsSlice:
-			for _, chat := range d.Chats {
-				if ch, ok := chat.(*tg.Channel); ok && ch.ID == channelID {
-					accessHash = ch.AccessHash
-					foundChannel = ch
-					break
-				}
-			}
-		}
-
-		if foundChannel == nil {
-			return fmt.Errorf("未找到频道 %d，请确认已加入该频道", channelID)
-		}
-
-		fmt.Printf("📢 频道名称: %s\n", foundChannel.Title)
-		inputPeer.AccessHash = accessHash
-	} else {
-		// 成功获取频道信息
-		switch chats := channel.(type) {
-		case *tg.MessagesChats:
-			if len(chats.Chats) > 0 {
-				if ch, ok := chats.Chats[0].(*tg.Channel); ok {
-					fmt.Printf("📢 频道名称: %s\n", ch.Title)
-					inputPeer.AccessHash = ch.AccessHash
-				}
-			}
-		}
+		return 0, err
 	}
 
 	// 获取历史消息
 	history, err := api.MessagesGetHistory(ctx, &tg.MessagesGetHistoryRequest{
-		Peer:       inputPeer,
+		Peer:       channel.AsInputPeer(),
 		OffsetID:   0,
 		OffsetDate: 0,
 		AddOffset:  0,
-		Limit:      100, // 获取最近100条
+		Limit:      limit,
 		MaxID:      0,
 		MinID:      0,
 		Hash:       0,
 	})
 
 	if err != nil {
-		return fmt.Errorf("获取历史消息失败: %w", err)
+		return 0, fmt.Errorf("获取历史消息失败: %w", err)
 	}
 
 	// 处理历史消息
 	var messages []tg.MessageClass
-	var users map[int64]*tg.User
-	var channels map[int64]*tg.Channel
-
-	switch h := history.(type) {
-	case *tg.MessagesMessages:
-		messages = h.Messages
-		users = make(map[int64]*tg.User)
-		for _, u := range h.Users {
-			if user, ok := u.(*tg.User); ok {
-				users[user.ID] = user
-			}
-		}
-		channels = make(map[int64]*tg.Channel)
-		for _, c := range h.Chats {
-			if channel, ok := c.(*tg.Channel); ok {
-				channels[channel.ID] = channel
-			}
-		}
-	case *tg.MessagesMessagesSlice:
-		messages = h.Messages
-		users = make(map[int64]*tg.User)
-		for _, u := range h.Users {
+	users := make(map[int64]*tg.User)
+	if modified, ok := history.AsModified(); ok {
+		messages = modified.GetMessages()
+		for _, u := range modified.GetUsers() {
 			if user, ok := u.(*tg.User); ok {
 				users[user.ID] = user
 			}
 		}
-		channels = make(map[int64]*tg.Channel)
-		for _, c := range h.Chats {
-			if channel, ok := c.(*tg.Channel); ok {
-				channels[channel.ID] = channel
-			}
-		}
-	case *tg.MessagesChannelMessages:
-		messages = h.Messages
-		users = make(map[int64]*tg.User)
-		for _, u := range h.Users {
-			if user, ok := u.(*tg.User); ok {
-				users[user.ID] = user
-			}
-		}
-		channels = make(map[int64]*tg.Channel)
-		for _, c := range h.Chats {
-			if channel, ok := c.(*tg.Channel); ok {
-				channels[channel.ID] = channel
-			}
-		}
 	}
 
-	fmt.Printf("📊 获取到 %d 条历史消息\n", len(messages))
+	logFilter.Info("获取到历史消息", "channel", channelID, "title", channel.Title, "messages", len(messages))
 
-	// 处理每条消息
-	matchCount := 0
+	var ordered []*tg.Message
 	for i := len(messages) - 1; i >= 0; i-- { // 倒序处理，从旧到新
 		msg, ok := messages[i].(*tg.Message)
 		if !ok {
 			continue
 		}
 
-		messageText := msg.Message
-		if messageText == "" {
+		if msg.Message == "" && msg.Media == nil {
 			continue
 		}
+		ordered = append(ordered, msg)
+	}
 
-		// 关键词匹配
-		matched := false
-		for _, keyword := range Keywords {
-			if strings.Contains(strings.ToLower(messageText), strings.ToLower(keyword)) {
-				matched = true
-				break
-			}
-		}
-
-		if !matched {
-			continue
-		}
-
-		// ✅ 检查是否在白名单中
-		isWhitelisted := false
-		for _, whiteID := range WhitelistChannels {
-			if whiteID == channelID {
-				isWhitelisted = true
-				break
-			}
-		}
-
-		// 如果不在白名单中,需要进行二次过滤
-		if !isWhitelisted {
-			// ✅ 消息内容二次过滤 - 检查是否包含“投稿”或“订阅”
-			contentMatched := false
-			for _, filterWord := range ContentFilter {
-				if strings.Contains(messageText, filterWord) {
-					contentMatched = true
-					break
-				}
-			}
-
-			if !contentMatched {
-				continue
-			}
-		}
-
-		// 提取消息中的链接
-		links := extractLinks(messageText)
-
-		// 只显示提取到的链接
-		if len(links) > 0 {
-			// 格式化时间
-			msgTime := time.Unix(int64(msg.Date), 0).Format("2006-01-02 15:04:05")
-
-			// 输出匹配的链接
-			for _, link := range links {
-				fmt.Printf("[%s] 频道:%d | %s\n",
-					msgTime,
-					channelID,
-					link)
-
-				// 🔥 自动添加订阅链接
-				success, message := addSubscription(link)
-				if success {
-					fmt.Printf("  ✅ 订阅添加成功: %s\n", message)
-				} else {
-					if message == "订阅已存在" {
-						fmt.Printf("  ⚠️  订阅已存在，跳过\n")
-					} else {
-						fmt.Printf("  ❌ 订阅添加失败: %s\n", message)
-					}
-				}
-			}
-
+	// 处理每条消息（相册合并为一组），与实时消息走同一套过滤流程
+	matchCount := 0
+	for _, group := range groupAlbums(ordered) {
+		// 格式化时间
+		msgTime := time.Unix(int64(group[0].Date), 0).Format("2006-01-02 15:04:05")
+		if l.processMessages(ctx, group, users, msgTime) {
 			matchCount++
 		}
 	}
 
-	fmt.Printf("✅ 频道 %d: 匹配到 %d 条消息\n", channelID, matchCount)
-	return nil
+	logFilter.Info("历史消息处理完成", "channel", channelID, "matched", matchCount)
+	return matchCount, nil
 }
 
-// addSubscription 添加订阅链接到订阅管理系统
-// 参数: subURL - 订阅链接
-// 返回: (成功, 消息)
-func addSubscription(subURL string) (bool, string) {
-	// 构建请求体
-	requestBody := map[string]string{
-		"sub_url": subURL,
-	}
-
-	jsonData, err := json.Marshal(requestBody)
-	if err != nil {
-		return false, fmt.Sprintf("JSON 编码失败: %v", err)
-	}
-
-	// 创建 HTTP 客户端，设置超时
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-
-	// 构建请求
-	apiURL := fmt.Sprintf("http://%s/api/config/add", SubscriptionAPIHost)
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return false, fmt.Sprintf("创建请求失败: %v", err)
-	}
-
-	// 设置请求头
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-API-Key", SubscriptionAPIKey)
-
-	// 发送请求
-	resp, err := client.Do(req)
-	if err != nil {
-		return false, fmt.Sprintf("API 请求失败: %v", err)
-	}
-	defer resp.Body.Close()
-
-	// 读取响应
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return false, fmt.Sprintf("读取响应失败: %v", err)
-	}
-
-	// 检查状态码
-	if resp.StatusCode != http.StatusOK {
-		return false, fmt.Sprintf("API 返回错误状态码 %d: %s", resp.StatusCode, string(body))
-	}
-
-	// 解析响应
-	var result struct {
-		Message string `json:"message"`
-		Error   string `json:"error"`
+// newSubscriptionSink 按配置创建订阅 API 客户端，dry-run 模式下按 links 判断链接是否已经提交过
+func newSubscriptionSink(s settings, client *http.Client, links *store.LinkStore) *sink.SubscriptionAPI {
+	return &sink.SubscriptionAPI{
+		Host:        s.SubscriptionAPIHost,
+		APIKey:      s.SubscriptionAPIKey,
+		RetractPath: s.SubscriptionAPIRetractPath,
+		Client:      client,
+		DryRun:      s.SubscriptionAPIDryRun,
+		Seen: func(link string) bool {
+			return linkSeen(links, link)
+		},
+		OnDryRun: func(method, url string, body []byte) {
+			logSink.Info("[dry-run] 订阅 API 请求未发送", "dry_run", true, "method", method, "url", url, "body", string(body))
+			metricDryRunRequests.WithLabelValues("subscription").Inc()
+		},
+		Observe: func(path string, elapsed time.Duration) {
+			metricSubscriptionLatency.WithLabelValues(path).Observe(elapsed.Seconds())
+		},
 	}
+}
 
-	if err := json.Unmarshal(body, &result); err != nil {
-		return false, fmt.Sprintf("解析响应失败: %v", err)
+// linkSeen 链接记录中是否已经提交过该链接（包括 dry-run）
+func linkSeen(links *store.LinkStore, link string) bool {
+	if links == nil {
+		return false
 	}
-
-	// 检查是否是重复订阅
-	if result.Error != "" {
-		if strings.Contains(result.Error, "已存在") || strings.Contains(strings.ToLower(result.Error), "already exists") {
-			return false, "订阅已存在"
+	for _, r := range links.FindLink(link) {
+		for _, l := range r.Links {
+			if l.URL == link && (l.Status == store.Submitted || l.Status == store.Duplicate || l.Status == store.DryRun) {
+				return true
+			}
 		}
-		return false, result.Error
 	}
-
-	return true, result.Message
+	return false
 }
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gotd/td/telegram/downloader"
+	"github.com/gotd/td/tg"
+)
+
+// documentDownloadTimeout 下载文本文件的超时，下载在更新处理器中进行，不能长时间阻塞
+const documentDownloadTimeout = 15 * time.Second
+
+// documentOptions 下载文本文件扫描链接的配置
+type documentOptions struct {
+	Scan       bool     // 是否下载文件
+	MaxSize    int64    // 超过该大小的文件不下载
+	Extensions []string // 按扩展名判断是否是文本文件
+}
+
+// messageContent 返回消息文本以及媒体中可能包含链接的内容：
+// 网页预览链接、投票问题和选项、文件名，以及开启后下载的小文本文件内容
+func messageContent(ctx context.Context, msg *tg.Message, docs documentOptions) string {
+	parts := []string{msg.Message}
+
+	switch media := msg.Media.(type) {
+	case *tg.MessageMediaWebPage:
+		if page, ok := media.Webpage.(*tg.WebPage); ok {
+			parts = append(parts, page.URL)
+			// display_url 不带协议，补上后交给链接提取器
+			if page.DisplayURL != "" && !strings.Contains(page.URL, page.DisplayURL) {
+				parts = append(parts, "https://"+page.DisplayURL)
+			}
+		}
+	case *tg.MessageMediaPoll:
+		parts = append(parts, media.Poll.Question)
+		for _, answer := range media.Poll.Answers {
+			parts = append(parts, answer.Text)
+		}
+	case *tg.MessageMediaDocument:
+		doc, ok := media.Document.(*tg.Document)
+		if !ok {
+			break
+		}
+		name := documentFileName(doc)
+		if name != "" {
+			parts = append(parts, name)
+		}
+		if docs.Scan {
+			content, err := downloadTextDocument(ctx, doc, name, docs)
+			if err != nil {
+				logFilter.Warn("下载文件失败", "file", name, "error", err)
+			} else if content != "" {
+				parts = append(parts, content)
+			}
+		}
+	}
+
+	return strings.Join(parts, "\n")
+}
+
+// documentFileName 返回文件名，没有文件名属性时返回空字符串
+func documentFileName(doc *tg.Document) string {
+	for _, attr := range doc.Attributes {
+		if name, ok := attr.(*tg.DocumentAttributeFilename); ok {
+			return name.FileName
+		}
+	}
+	return ""
+}
+
+// isTextDocument 按扩展名判断是否是需要扫描的文本文件
+func isTextDocument(name string, extensions []string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, allowed := range extensions {
+		if ext == strings.ToLower(allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// downloadTextDocument 下载小文本文件并返回内容，超过大小限制或不是文本文件时返回空字符串
+func downloadTextDocument(ctx context.Context, doc *tg.Document, name string, docs documentOptions) (string, error) {
+	if !isTextDocument(name, docs.Extensions) || doc.Size > docs.MaxSize {
+		return "", nil
+	}
+
+	api := tgAPI.Load()
+	if api == nil {
+		return "", fmt.Errorf("客户端未就绪")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, documentDownloadTimeout)
+	defer cancel()
+
+	var buf bytes.Buffer
+	if _, err := downloader.NewDownloader().Download(api, doc.AsInputDocumentFileLocation()).Stream(ctx, &buf); err != nil {
+		return "", err
+	}
+	if !utf8.Valid(buf.Bytes()) {
+		return "", nil
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/gotd/td/telegram/dcs"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// 指标名称前缀
+const metricsNamespace = "tgmsg"
+
+var (
+	metricUpdates = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "updates_received_total",
+		Help:      "收到的 Telegram 更新数",
+	})
+	metricMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "messages_total",
+		Help:      "各监听频道收到的消息数，不在监听列表中的频道为 other",
+	}, []string{"channel"})
+	metricMatches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "filter_matches_total",
+		Help:      "通过过滤并提取到链接的消息数",
+	}, []string{"channel"})
+	metricLinks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "links_total",
+		Help:      "链接处理数量，result 为 extracted / blacklisted / submitted / duplicate / failed / dry_run",
+	}, []string{"result"})
+	metricSubscriptionLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "subscription_api_duration_seconds",
+		Help:      "订阅 API 请求耗时",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"path"})
+	metricDials = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "dial_attempts_total",
+		Help:      "连接 Telegram DC 的次数",
+	}, []string{"dc", "proxy"})
+	metricDialFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "dial_failures_total",
+		Help:      "连接 Telegram DC 失败的次数",
+	}, []string{"dc", "proxy"})
+	metricConnected = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "connected",
+		Help:      "是否已连接并登录 Telegram（1 已连接，0 未连接）",
+	})
+	metricLastUpdate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "last_message_timestamp_seconds",
+		Help:      "各频道最近一条消息的时间",
+	}, []string{"channel"})
+	metricDryRun = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "dry_run",
+		Help:      "各输出是否处于 dry-run 模式（1 是，0 否），sink 为 subscription / forward / notify",
+	}, []string{"sink"})
+	metricDryRunRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "dry_run_requests_total",
+		Help:      "dry-run 模式下只记录、没有实际发送的请求数",
+	}, []string{"sink"})
+)
+
+// registerQueueMetrics 注册各队列长度的指标，队列长度在采集时读取
+func registerQueueMetrics(l *listener) {
+	queues := map[string]func() int{
+		"forward": func() int {
+			if l.forwards == nil {
+				return 0
+			}
+			return l.forwards.Pending()
+		},
+		"notify": func() int {
+			if l.notices == nil {
+				return 0
+			}
+			return l.notices.Pending()
+		},
+		"albums": func() int {
+			if l.albums == nil {
+				return 0
+			}
+			return l.albums.Pending()
+		},
+	}
+	for name, pending := range queues {
+		pending := pending
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Name:        "queue_depth",
+			Help:        "队列中等待处理的数量",
+			ConstLabels: prometheus.Labels{"queue": name},
+		}, func() float64 { return float64(pending()) })
+	}
+}
+
+// 生产环境 DC 地址 -> DC ID
+var dcAddresses = func() map[string]string {
+	m := make(map[string]string)
+	for _, opt := range dcs.Prod().Options {
+		m[net.JoinHostPort(opt.IPAddress, strconv.Itoa(opt.Port))] = strconv.Itoa(opt.ID)
+	}
+	return m
+}()
+
+// dcLabel 返回连接地址对应的 DC ID，未知地址（如 MTProxy）直接返回地址
+func dcLabel(address string) string {
+	if id, ok := dcAddresses[address]; ok {
+		return id
+	}
+	return address
+}
+
+// otherChannelLabel 不在监听列表中的频道共用的指标标签
+const otherChannelLabel = "other"
+
+// channelLabel 频道 ID 作为指标标签
+func channelLabel(channelID int64) string {
+	return strconv.FormatInt(channelID, 10)
+}
+
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+
+	"simple-listener/internal/extractor"
+	"simple-listener/internal/store"
+)
+
+// 汇总周期
+const (
+	digestHourly = "hourly"
+	digestDaily  = "daily"
+)
+
+// 两条通知之间的最短间隔，避免触发 FLOOD_WAIT
+const notifyInterval = 3 * time.Second
+
+// digestCount 单个频道在汇总周期内的链接处理数量
+type digestCount struct {
+	Submitted int
+	Duplicate int
+	Failed    int
+}
+
+// notifier 通过当前登录的账号把订阅 API 的处理结果发送到收藏夹或指定对话
+type notifier struct {
+	target      string
+	linkResults bool          // 是否发送每个链接的处理结果
+	digest      time.Duration // 汇总周期，0 表示不发送汇总
+	threshold   int           // 连续失败多少次后告警
+	messages    chan string
+	dryRun      bool // 只记录日志，不实际发送
+
+	mu       sync.Mutex
+	peer     tg.InputPeerClass
+	counts   map[string]*digestCount // 频道标签 -> 数量
+	failures int                     // 连续失败次数
+	alerted  bool                    // 是否已发送失败告警
+}
+
+// newNotifier 创建通知器，digest 为 hourly / daily / 空
+func newNotifier(target string, linkResults bool, digest string, threshold int) (*notifier, error) {
+	if strings.TrimSpace(target) == "" {
+		return nil, fmt.Errorf("没有设置通知目标 notify.target（me / @username / 频道 ID）")
+	}
+	n := &notifier{
+		target:      target,
+		linkResults: linkResults,
+		threshold:   threshold,
+		messages:    make(chan string, 100),
+		counts:      make(map[string]*digestCount),
+	}
+	switch digest {
+	case "":
+	case digestHourly:
+		n.digest = time.Hour
+	case digestDaily:
+		n.digest = 24 * time.Hour
+	default:
+		return nil, fmt.Errorf("不支持的汇总周期: %s", digest)
+	}
+	if n.threshold <= 0 {
+		n.threshold = 3
+	}
+	return n, nil
+}
+
+// LinkResults 记录一条消息中各链接的处理结果，开启后发送结果通知，连续失败达到阈值时告警
+// channel 是频道标签，汇总按频道统计；source 带有原始来源和发送者，只用于结果通知
+func (n *notifier) LinkResults(channel, source string, records []*store.LinkRecord) {
+	if len(records) == 0 {
+		return
+	}
+
+	n.mu.Lock()
+	count, ok := n.counts[channel]
+	if !ok {
+		count = &digestCount{}
+		n.counts[channel] = count
+	}
+	var alert, recovered bool
+	var lastErr string
+	for _, r := range records {
+		switch r.Status {
+		case store.Submitted:
+			count.Submitted++
+		case store.Duplicate:
+			count.Duplicate++
+		case store.Failed:
+			count.Failed++
+		}
+
+		// 重复订阅说明 API 正常工作，也视为成功
+		if r.Status == store.Failed {
+			n.failures++
+			lastErr = r.Message
+			if n.failures >= n.threshold && !n.alerted {
+				n.alerted = true
+				alert = true
+			}
+		} else {
+			n.failures = 0
+			if n.alerted {
+				n.alerted = false
+				recovered = true
+			}
+		}
+	}
+	failures := n.failures
+	n.mu.Unlock()
+
+	if n.linkResults {
+		var b strings.Builder
+		fmt.Fprintf(&b, "📨 %s\n", source)
+		for _, r := range records {
+			fmt.Fprintf(&b, "%s %s", statusIcon(r.Status), r.URL)
+			if r.Message != "" {
+				fmt.Fprintf(&b, "\n    %s", r.Message)
+			}
+			b.WriteString("\n")
+		}
+		n.Send(b.String())
+	}
+	if alert {
+		n.Send(fmt.Sprintf("🚨 订阅 API 连续失败 %d 次\n最近错误: %s", failures, stripLinks(lastErr)))
+	}
+	if recovered {
+		n.Send("✅ 订阅 API 已恢复正常")
+	}
+}
+
+// stripLinks 去掉错误信息中的链接（如订阅 API 地址），告警内容不会泄露地址，也不会被当作订阅提交
+func stripLinks(text string) string {
+	for _, link := range extractor.FindLinks(text) {
+		text = strings.ReplaceAll(text, link, "<链接>")
+	}
+	return text
+}
+
+// statusIcon 返回链接处理结果对应的图标
+func statusIcon(status string) string {
+	switch status {
+	case store.Submitted:
+		return "✅"
+	case store.Duplicate:
+		return "⚠️"
+	case store.DryRun:
+		return "🧪"
+	default:
+		return "❌"
+	}
+}
+
+// Send 加入发送队列，队列已满时丢弃
+func (n *notifier) Send(text string) {
+	select {
+	case n.messages <- strings.TrimSpace(text):
+	default:
+		logSink.Warn("通知队列已满，跳过")
+	}
+}
+
+// Pending 返回等待发送的通知数
+func (n *notifier) Pending() int {
+	return len(n.messages)
+}
+
+// Run 发送队列中的通知并定时发送汇总，直到 ctx 结束
+func (n *notifier) Run(ctx context.Context) {
+	var digestC <-chan time.Time
+	if n.digest > 0 {
+		ticker := time.NewTicker(n.digest)
+		defer ticker.Stop()
+		digestC = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-digestC:
+			if text := n.takeDigest(); text != "" {
+				n.Send(text)
+			}
+		case text := <-n.messages:
+			if err := retryFloodWait(ctx, func() error { return n.deliver(ctx, text) }); err != nil {
+				logSink.Error("发送通知失败", "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(notifyInterval):
+			}
+		}
+	}
+}
+
+// takeDigest 生成汇总周期内各频道的统计并清零，没有数据时返回空字符串
+func (n *notifier) takeDigest() string {
+	n.mu.Lock()
+	counts := n.counts
+	n.counts = make(map[string]*digestCount)
+	n.mu.Unlock()
+
+	if len(counts) == 0 {
+		return ""
+	}
+
+	sources := make([]string, 0, len(counts))
+	for source := range counts {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	var b strings.Builder
+	var total digestCount
+	fmt.Fprintf(&b, "📊 最近 %v 订阅汇总\n", n.digest)
+	for _, source := range sources {
+		c := counts[source]
+		fmt.Fprintf(&b, "%s: 成功 %d / 已存在 %d / 失败 %d\n", source, c.Submitted, c.Duplicate, c.Failed)
+		total.Submitted += c.Submitted
+		total.Duplicate += c.Duplicate
+		total.Failed += c.Failed
+	}
+	fmt.Fprintf(&b, "合计: 成功 %d / 已存在 %d / 失败 %d", total.Submitted, total.Duplicate, total.Failed)
+	return b.String()
+}
+
+// isTarget 判断对话是否是通知目标
+func (n *notifier) isTarget(peer tg.PeerClass) bool {
+	n.mu.Lock()
+	resolved := n.peer
+	n.mu.Unlock()
+	return targetMatches(n.target, resolved, peer)
+}
+
+// deliver 发送一条通知
+func (n *notifier) deliver(ctx context.Context, text string) error {
+	if n.dryRun {
+		logSink.Info("[dry-run] 通知未发送", "dry_run", true, "target", n.target, "text", text)
+		metricDryRunRequests.WithLabelValues("notify").Inc()
+		return nil
+	}
+
+	api := tgAPI.Load()
+	if api == nil {
+		return fmt.Errorf("客户端未就绪")
+	}
+
+	n.mu.Lock()
+	peer := n.peer
+	n.mu.Unlock()
+	if peer == nil {
+		var err error
+		if peer, err = resolvePeer(ctx, api, n.target); err != nil {
+			return fmt.Errorf("解析通知目标失败: %w", err)
+		}
+		n.mu.Lock()
+		n.peer = peer
+		n.mu.Unlock()
+	}
+
+	_, err := api.MessagesSendMessage(ctx, &tg.MessagesSendMessageRequest{
+		Peer:      peer,
+		Message:   text,
+		RandomID:  randomID(),
+		NoWebpage: true,
+	})
+	return err
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/telegram/dcs"
+	"github.com/gotd/td/transport"
+	"golang.org/x/net/proxy"
+)
+
+// 代理选择策略
+const (
+	strategyPriority   = "priority"    // 按配置顺序，优先使用靠前的健康代理
+	strategyRoundRobin = "round_robin" // 在健康代理之间轮询
+)
+
+// 健康检查时连接的目标地址（Telegram DC2）
+const proxyProbeTarget = "149.154.167.50:443"
+
+// proxyEntry 代理池中的单个代理及其健康状态
+type proxyEntry struct {
+	cfg      *proxyConfig
+	dialer   proxy.ContextDialer
+	resolver dcs.Resolver
+
+	healthy  bool
+	failures int
+	lastErr  error
+}
+
+// proxyPool 多个上游代理组成的代理池，实现 dcs.Resolver 接口
+// 连接失败时自动切换到下一个代理
+type proxyPool struct {
+	mu       sync.Mutex
+	entries  []*proxyEntry
+	strategy string
+	next     int
+	current  *proxyEntry
+}
+
+var _ dcs.Resolver = (*proxyPool)(nil)
+
+// newProxyPool 创建代理池
+// wrapDial 用于给每个代理的拨号函数加上日志、超时等包装
+func newProxyPool(rawProxies []string, strategy string, wrapDial func(p *proxyConfig, d proxy.ContextDialer) dcs.DialFunc) (*proxyPool, error) {
+	switch strategy {
+	case "":
+		strategy = strategyPriority
+	case strategyPriority, strategyRoundRobin:
+	default:
+		return nil, fmt.Errorf("不支持的代理选择策略: %s", strategy)
+	}
+
+	pool := &proxyPool{strategy: strategy}
+	for _, raw := range rawProxies {
+		cfg, err := parseProxy(raw)
+		if err != nil {
+			return nil, err
+		}
+		dialer, err := cfg.Dialer()
+		if err != nil {
+			return nil, err
+		}
+		resolver, err := cfg.Resolver(wrapDial(cfg, dialer))
+		if err != nil {
+			return nil, fmt.Errorf("代理 %s 配置失败: %w", cfg, err)
+		}
+		pool.entries = append(pool.entries, &proxyEntry{
+			cfg:      cfg,
+			dialer:   dialer,
+			resolver: resolver,
+			healthy:  true, // 未检查前默认可用
+		})
+	}
+	if len(pool.entries) == 0 {
+		return nil, fmt.Errorf("未配置任何代理")
+	}
+	pool.current = pool.entries[0]
+	return pool, nil
+}
+
+// Current 返回当前正在使用的代理
+func (p *proxyPool) Current() *proxyConfig {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.current.cfg
+}
+
+// Len 返回代理数量
+func (p *proxyPool) Len() int {
+	return len(p.entries)
+}
+
+// candidates 按策略返回本次连接尝试的代理顺序，健康的代理排在前面
+func (p *proxyPool) candidates() []*proxyEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ordered := make([]*proxyEntry, 0, len(p.entries))
+	start := 0
+	if p.strategy == strategyRoundRobin {
+		start = p.next % len(p.entries)
+		p.next++
+	}
+	for i := range p.entries {
+		e := p.entries[(start+i)%len(p.entries)]
+		if e.healthy {
+			ordered = append(ordered, e)
+		}
+	}
+	// 不健康的代理作为最后的备选
+	for i := range p.entries {
+		e := p.entries[(start+i)%len(p.entries)]
+		if !e.healthy {
+			ordered = append(ordered, e)
+		}
+	}
+	return ordered
+}
+
+// markOK 记录代理可用，并在切换代理时输出日志
+func (p *proxyPool) markOK(e *proxyEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e.healthy = true
+	e.failures = 0
+	e.lastErr = nil
+	if p.current != e {
+		logProxy.Info("切换代理", "from", p.current.cfg.String(), "to", e.cfg.String())
+		p.current = e
+	}
+}
+
+// markFailed 记录代理失败
+func (p *proxyPool) markFailed(e *proxyEntry, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e.healthy = false
+	e.failures++
+	e.lastErr = err
+}
+
+// try 按顺序尝试代理，直到连接成功
+func (p *proxyPool) try(ctx context.Context, connect func(r dcs.Resolver) (transport.Conn, error)) (transport.Conn, error) {
+	var errs []error
+	for _, e := range p.candidates() {
+		conn, err := connect(e.resolver)
+		if err == nil {
+			p.markOK(e)
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		p.markFailed(e, err)
+		errs = append(errs, fmt.Errorf("%s: %w", e.cfg, err))
+		if len(p.entries) > 1 {
+			logProxy.Warn("代理连接失败，尝试下一个代理", "proxy", e.cfg.String())
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (p *proxyPool) Primary(ctx context.Context, dc int, list dcs.List) (transport.Conn, error) {
+	return p.try(ctx, func(r dcs.Resolver) (transport.Conn, error) {
+		return r.Primary(ctx, dc, list)
+	})
+}
+
+func (p *proxyPool) MediaOnly(ctx context.Context, dc int, list dcs.List) (transport.Conn, error) {
+	return p.try(ctx, func(r dcs.Resolver) (transport.Conn, error) {
+		return r.MediaOnly(ctx, dc, list)
+	})
+}
+
+func (p *proxyPool) CDN(ctx context.Context, dc int, list dcs.List) (transport.Conn, error) {
+	return p.try(ctx, func(r dcs.Resolver) (transport.Conn, error) {
+		return r.CDN(ctx, dc, list)
+	})
+}
+
+// probe 检查单个代理是否可以连通 Telegram
+// MTProxy 只检查代理服务器本身是否可以连接
+func (p *proxyPool) probe(ctx context.Context, e *proxyEntry) {
+	target := proxyProbeTarget
+	if e.cfg.Kind == proxyMTProxy {
+		target = e.cfg.Addr
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	conn, err := e.dialer.DialContext(probeCtx, "tcp", target)
+	if err == nil {
+		conn.Close()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	wasHealthy := e.healthy
+	if err != nil {
+		e.healthy = false
+		e.failures++
+		e.lastErr = err
+		if wasHealthy {
+			logProxy.Warn("代理健康检查失败", "proxy", e.cfg.String(), "error", err)
+		}
+		return
+	}
+
+	e.healthy = true
+	e.failures = 0
+	e.lastErr = nil
+	if !wasHealthy {
+		logProxy.Info("代理已恢复", "proxy", e.cfg.String())
+	}
+}
+
+// RunHealthCheck 定期检查所有代理的健康状态，直到 ctx 结束
+func (p *proxyPool) RunHealthCheck(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, e := range p.entries {
+			p.probe(ctx, e)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Status 返回所有代理的状态描述，用于状态输出
+func (p *proxyPool) Status() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	lines := make([]string, 0, len(p.entries))
+	for _, e := range p.entries {
+		state := "✅"
+		if !e.healthy {
+			state = "❌"
+		}
+		line := fmt.Sprintf("%s %s", state, e.cfg)
+		if e == p.current {
+			line += " (当前)"
+		}
+		if e.lastErr != nil {
+			line += fmt.Sprintf(" 失败%d次: %v", e.failures, e.lastErr)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// HTTPClient 返回跟随代理池当前代理的 HTTP 客户端
+// MTProxy 只能转发 MTProto 流量，HTTP 请求仍然直连
+func (p *proxyPool) HTTPClient(timeout time.Duration) *http.Client {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = func(*http.Request) (*url.URL, error) {
+		cfg := p.Current()
+		switch cfg.Kind {
+		case proxySOCKS5, proxyHTTP:
+			return cfg.URL, nil
+		default:
+			return nil, nil
+		}
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: tr,
+	}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/tg"
+
+	"simple-listener/internal/config"
+	"simple-listener/internal/filter"
+	"simple-listener/internal/sink"
+	"simple-listener/internal/store"
+)
+
+// replayMessage 回放的一条消息
+type replayMessage struct {
+	Title string // 对话名称
+	Msg   *tg.Message
+	Users map[int64]*tg.User
+}
+
+// desktopChat Telegram Desktop 导出的单个对话
+type desktopChat struct {
+	Name     string           `json:"name"`
+	Type     string           `json:"type"`
+	ID       int64            `json:"id"`
+	Messages []desktopMessage `json:"messages"`
+}
+
+// desktopExport Telegram Desktop 导出的 result.json，可以是单个对话或整个账号
+type desktopExport struct {
+	desktopChat
+	Chats struct {
+		List []desktopChat `json:"list"`
+	} `json:"chats"`
+}
+
+// desktopMessage Telegram Desktop 导出的消息
+type desktopMessage struct {
+	ID              int             `json:"id"`
+	Type            string          `json:"type"`
+	Date            string          `json:"date"`
+	DateUnix        string          `json:"date_unixtime"`
+	EditedUnix      string          `json:"edited_unixtime"`
+	From            string          `json:"from"`
+	FromID          string          `json:"from_id"`
+	ForwardedFrom   string          `json:"forwarded_from"`
+	ForwardedFromID string          `json:"forwarded_from_id"`
+	Text            json.RawMessage `json:"text"`
+}
+
+// runReplay replay 子命令：用导出的消息离线测试过滤规则，不提交订阅、不转发、不发送通知
+// 通过过滤的链接按 dry-run 交给订阅 API，检查链接格式，并按链接记录和之前回放的消息去重
+//
+//	simple-listener replay [-all-channels] [-matched] result.json|archive.jsonl...
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: simple-listener replay [选项] result.json|归档.jsonl...")
+		fmt.Fprintln(fs.Output(), "支持 Telegram Desktop 导出的 result.json，以及 search -json 输出的 JSONL 归档")
+		fs.PrintDefaults()
+	}
+	var (
+		allChannels = fs.Bool("all-channels", false, "不检查 monitor.channels，所有对话都按监听频道处理")
+		onlyMatched = fs.Bool("matched", false, "只显示有需要提交的链接的消息")
+		noTrace     = fs.Bool("no-trace", false, "不显示过滤链每一步的判断")
+	)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	c, err := config.Load(configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	// 回放只输出结果，日志只显示警告和错误
+	logConfig := c.Log
+	logConfig.Level, logConfig.Components, logConfig.File = "warn", nil, ""
+	if _, err := setupLogging(logConfig); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *allChannels {
+		c.Monitor.Channels = nil
+	}
+	// 链接记录只用于去重，回放结果不写回
+	s := newSettings(c)
+	links, err := store.NewLinkStore(s.StoreFile, 0)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	l := newReplayListener(c, s, links)
+
+	var messages []replayMessage
+	for _, path := range fs.Args() {
+		loaded, err := loadReplayFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		messages = append(messages, loaded...)
+	}
+
+	ctx := context.Background()
+	outcomes := make(map[string]int)
+	for _, m := range messages {
+		src, text, results, verdict := l.replay(ctx, m)
+		outcomes[verdict.Outcome]++
+		if *onlyMatched && !verdict.Matched() {
+			continue
+		}
+		printReplayResult(m, src, text, results, verdict, !*noTrace)
+	}
+
+	names := make([]string, 0, len(outcomes))
+	for name := range outcomes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	summary := make([]string, 0, len(names))
+	for _, name := range names {
+		summary = append(summary, fmt.Sprintf("%s %d", name, outcomes[name]))
+	}
+	fmt.Printf("共 %d 条消息：%s\n", len(messages), strings.Join(summary, "，"))
+	return 0
+}
+
+// newReplayListener 创建只执行过滤链的 listener，不记录消息、不转发、不发送通知
+// 链接提交到 dry-run 模式的订阅 API，已在 links 中提交过或回放中已出现过的链接视为已存在
+func newReplayListener(c config.Config, s settings, links *store.LinkStore) *listener {
+	s.SubscriptionAPIDryRun = true
+	api := newSubscriptionSink(s, http.DefaultClient, links)
+	replayed := make(map[string]bool)
+	api.Seen = func(link string) bool {
+		if replayed[link] || linkSeen(links, link) {
+			return true
+		}
+		replayed[link] = true
+		return false
+	}
+	api.OnDryRun = nil
+	return newListener(configFile, c, s, nil, api)
+}
+
+// replay 过滤一条回放的消息，通过过滤时返回各链接的 dry-run 提交结果
+// 有链接结果时 verdict.Outcome 为链接的处理结果，与归档中的一致
+func (l *listener) replay(ctx context.Context, m replayMessage) (messageSource, string, []sink.Result, filter.Verdict) {
+	src, text, links, verdict := l.filterMessages(ctx, []*tg.Message{m.Msg}, m.Users)
+	if !verdict.Matched() {
+		return src, text, nil, verdict
+	}
+	results := l.pipeline.Submit(ctx, filterMessage(src, ""), links)
+	records := make([]*store.LinkRecord, 0, len(results))
+	for _, r := range results {
+		records = append(records, &store.LinkRecord{URL: r.URL, Status: r.Status})
+	}
+	if outcome := linksOutcome(records); outcome != "" {
+		verdict.Outcome = outcome
+	}
+	return src, text, results, verdict
+}
+
+// printReplayResult 输出一条消息的过滤结果
+// trace 为 true 时输出过滤链每一步的判断
+func printReplayResult(m replayMessage, src messageSource, text string, results []sink.Result, verdict filter.Verdict, trace bool) {
+	header := fmt.Sprintf("[%s] %s #%d  %s",
+		time.Unix(int64(m.Msg.Date), 0).Format("2006-01-02 15:04"), replayTitle(m, src), m.Msg.ID, verdict.Outcome)
+	if verdict.Rule != "" {
+		header += "  (" + verdict.Rule + ")"
+	}
+	fmt.Println(header)
+
+	if text == "" {
+		text = m.Msg.Message
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if r := []rune(text); len(r) > 200 {
+		text = string(r[:200]) + "…"
+	}
+	fmt.Println("  " + text)
+	for _, r := range results {
+		fmt.Println(strings.TrimRight(fmt.Sprintf("  → %s  [%s] %s", r.URL, r.Status, r.Message), " "))
+	}
+	if trace {
+		for _, s := range verdict.Trace {
+			fmt.Println("    " + s.String())
+		}
+	}
+	fmt.Println()
+}
+
+// replayTitle 对话名称加上来源
+func replayTitle(m replayMessage, src messageSource) string {
+	label := src.Label()
+	if m.Title == "" {
+		return label
+	}
+	if label == "" {
+		return m.Title
+	}
+	return m.Title + " (" + label + ")"
+}
+
+// loadReplayFile 读取回放文件，.jsonl 按归档读取，其他按 Telegram Desktop 导出读取
+func loadReplayFile(path string) ([]replayMessage, error) {
+	if strings.EqualFold(filepath.Ext(path), ".jsonl") {
+		return loadArchiveJSONL(path)
+	}
+	return loadDesktopExport(path)
+}
+
+// loadDesktopExport 读取 Telegram Desktop 导出的 result.json
+func loadDesktopExport(path string) ([]replayMessage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取导出文件失败: %w", err)
+	}
+	var export desktopExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("解析导出文件 %s 失败: %w", path, err)
+	}
+
+	chats := export.Chats.List
+	if len(export.Messages) > 0 {
+		chats = append(chats, export.desktopChat)
+	}
+	var messages []replayMessage
+	for _, chat := range chats {
+		peer := desktopPeer(chat)
+		for _, dm := range chat.Messages {
+			if dm.Type != "message" {
+				continue
+			}
+			msg, users := dm.toMessage(peer)
+			if msg.Message == "" {
+				continue
+			}
+			messages = append(messages, replayMessage{Title: chat.Name, Msg: msg, Users: users})
+		}
+	}
+	return messages, nil
+}
+
+// desktopPeer 按导出的对话类型返回消息所在的对话
+func desktopPeer(chat desktopChat) tg.PeerClass {
+	switch chat.Type {
+	case "personal_chat", "bot_chat", "saved_messages":
+		return &tg.PeerUser{UserID: chat.ID}
+	case "private_group":
+		return &tg.PeerChat{ChatID: chat.ID}
+	default:
+		// 频道和超级群组
+		return &tg.PeerChannel{ChannelID: chat.ID}
+	}
+}
+
+// toMessage 转换为 tg.Message，users 中包含发送者
+func (dm desktopMessage) toMessage(peer tg.PeerClass) (*tg.Message, map[int64]*tg.User) {
+	msg := &tg.Message{
+		ID:      dm.ID,
+		PeerID:  peer,
+		Message: desktopText(dm.Text),
+	}
+	if unix, err := strconv.ParseInt(dm.DateUnix, 10, 64); err == nil {
+		msg.Date = int(unix)
+	} else if t, err := time.ParseInLocation("2006-01-02T15:04:05", dm.Date, time.Local); err == nil {
+		msg.Date = int(t.Unix())
+	}
+	if unix, err := strconv.ParseInt(dm.EditedUnix, 10, 64); err == nil {
+		msg.SetEditDate(int(unix))
+	}
+
+	users := make(map[int64]*tg.User)
+	if from := desktopPeerID(dm.FromID); from != nil {
+		msg.SetFromID(from)
+		if user, ok := from.(*tg.PeerUser); ok {
+			users[user.UserID] = &tg.User{ID: user.UserID, FirstName: dm.From}
+		}
+	}
+	if dm.ForwardedFrom != "" || dm.ForwardedFromID != "" {
+		fwd := tg.MessageFwdHeader{Date: msg.Date}
+		if from := desktopPeerID(dm.ForwardedFromID); from != nil {
+			fwd.SetFromID(from)
+		} else {
+			fwd.SetFromName(dm.ForwardedFrom)
+		}
+		msg.SetFwdFrom(fwd)
+	}
+	return msg, users
+}
+
+// desktopPeerID 解析 "user123"、"channel123" 形式的 ID
+func desktopPeerID(s string) tg.PeerClass {
+	for prefix, peer := range map[string]func(int64) tg.PeerClass{
+		"user":    func(id int64) tg.PeerClass { return &tg.PeerUser{UserID: id} },
+		"channel": func(id int64) tg.PeerClass { return &tg.PeerChannel{ChannelID: id} },
+		"chat":    func(id int64) tg.PeerClass { return &tg.PeerChat{ChatID: id} },
+	} {
+		if rest, ok := strings.CutPrefix(s, prefix); ok {
+			if id, err := strconv.ParseInt(rest, 10, 64); err == nil {
+				return peer(id)
+			}
+		}
+	}
+	return nil
+}
+
+// desktopText 拼接导出的消息文本，text 可以是字符串，或字符串与 {"type": ..., "text": ...} 的数组
+// 与实时消息一致，隐藏在文字后面的链接（text_link）不参与匹配
+func desktopText(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	var parts []json.RawMessage
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, part := range parts {
+		if err := json.Unmarshal(part, &s); err == nil {
+			b.WriteString(s)
+			continue
+		}
+		var entity struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(part, &entity); err == nil {
+			b.WriteString(entity.Text)
+		}
+	}
+	return b.String()
+}
+
+// loadArchiveJSONL 读取 search -json 输出的归档消息
+func loadArchiveJSONL(path string) ([]replayMessage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取归档文件失败: %w", err)
+	}
+	defer f.Close()
+
+	var messages []replayMessage
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var e store.ArchiveEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("解析归档文件 %s 第 %d 行失败: %w", path, line, err)
+		}
+		if len(e.MessageIDs) == 0 {
+			continue
+		}
+		msg := &tg.Message{
+			ID:      e.MessageIDs[0],
+			PeerID:  &tg.PeerChannel{ChannelID: e.PeerID},
+			Date:    int(e.Date.Unix()),
+			Message: e.Text,
+		}
+		messages = append(messages, replayMessage{Msg: msg})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取归档文件失败: %w", err)
+	}
+	return messages, nil
+}
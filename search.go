@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"simple-listener/internal/config"
+	"simple-listener/internal/store"
+)
+
+// runSearch search 子命令：搜索消息归档，返回退出码
+//
+//	simple-listener search [-channel ID|名称] [-since 7d|2006-01-02] [-until 2006-01-02] [-host example.com] [关键词...]
+func runSearch(args []string) int {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: simple-listener search [选项] [关键词...]")
+		fs.PrintDefaults()
+	}
+	var (
+		db      = fs.String("db", "", "归档数据库文件，默认读取 config.yaml 中的 archive.file")
+		channel = fs.String("channel", "", "频道 ID，或来源名称的一部分")
+		since   = fs.String("since", "", "开始时间：2006-01-02、2006-01-02 15:04，或 7d、12h 表示最近一段时间")
+		until   = fs.String("until", "", "结束时间（不包含），只写日期时包含当天")
+		host    = fs.String("host", "", "链接域名，包括子域名")
+		limit   = fs.Int("limit", 50, "最多显示的条数，0 表示不限制")
+		asJSON  = fs.Bool("json", false, "以 JSON Lines 格式输出")
+	)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	q := store.ArchiveQuery{
+		Text:    strings.Join(fs.Args(), " "),
+		Channel: *channel,
+		Host:    *host,
+		Limit:   *limit,
+	}
+	var err error
+	now := time.Now()
+	if q.Since, err = parseTimeArg(*since, now, false); err != nil {
+		fmt.Fprintf(os.Stderr, "-since: %v\n", err)
+		return 2
+	}
+	if q.Until, err = parseTimeArg(*until, now, true); err != nil {
+		fmt.Fprintf(os.Stderr, "-until: %v\n", err)
+		return 2
+	}
+
+	path := *db
+	if path == "" {
+		c, err := config.Load(configFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		path = newSettings(c).ArchiveFile
+	}
+	if _, err := os.Stat(path); err != nil {
+		fmt.Fprintf(os.Stderr, "归档数据库不存在: %s（需要在配置中开启 archive.enabled）\n", path)
+		return 1
+	}
+	a, err := store.OpenArchive(path, 0)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer a.Close()
+
+	entries, err := a.Search(q)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+		}
+		return 0
+	}
+	for _, e := range entries {
+		printArchiveEntry(e)
+	}
+	fmt.Printf("共 %d 条\n", len(entries))
+	return 0
+}
+
+// printArchiveEntry 输出一条归档消息
+func printArchiveEntry(e *store.ArchiveEntry) {
+	header := fmt.Sprintf("[%s] %s #%d  %s", e.Date.Format("2006-01-02 15:04"), e.Source, e.MessageIDs[0], e.Outcome)
+	if e.Rule != "" {
+		header += "  (" + e.Rule + ")"
+	}
+	if e.Deleted {
+		header += "  已删除"
+	}
+	fmt.Println(header)
+
+	text := strings.Join(strings.Fields(e.Text), " ")
+	if r := []rune(text); len(r) > 200 {
+		text = string(r[:200]) + "…"
+	}
+	if text != "" {
+		fmt.Println("  " + text)
+	}
+	for _, l := range e.Links {
+		fmt.Printf("  %s (%s)\n", l.URL, l.Status)
+	}
+	fmt.Println()
+}
+
+// parseTimeArg 解析命令行中的时间
+// 支持 2006-01-02、2006-01-02 15:04、RFC3339，以及 7d、12h 等相对现在的时间
+// end 为 true 且只写日期时返回第二天 0 点，使结束日期包含当天
+func parseTimeArg(s string, now time.Time, end bool) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if strings.HasSuffix(s, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil {
+			return now.AddDate(0, 0, -days), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02 15:04:05", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("无法解析时间: %s", s)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// 管理员列表缓存时间，获取失败时缓存错误的时间较短，避免每条消息都重新请求触发 FLOOD_WAIT
+const (
+	adminCacheTTL = time.Hour
+	adminErrorTTL = time.Minute
+)
+
+// adminEntry 单个群组的管理员列表或获取失败的错误
+type adminEntry struct {
+	admins  map[int64]bool // 管理员用户 ID
+	err     error
+	expires time.Time
+	loading chan struct{} // 正在获取时非 nil，获取完成后关闭
+}
+
+// adminCache 缓存群组的管理员列表
+// 获取管理员列表是网络请求，不持有锁，同一群组同时只有一个请求
+type adminCache struct {
+	mu      sync.Mutex
+	entries map[int64]*adminEntry // 群组 ID -> 管理员列表
+	fetch   func(ctx context.Context, chatID int64) (map[int64]bool, error)
+}
+
+var admins = &adminCache{
+	entries: make(map[int64]*adminEntry),
+	fetch:   fetchAdmins,
+}
+
+// isAdmin 检查用户是否是群组管理员，缓存过期时重新获取管理员列表
+func (c *adminCache) isAdmin(ctx context.Context, chatID, userID int64) (bool, error) {
+	for {
+		c.mu.Lock()
+		e := c.entries[chatID]
+		if e != nil && e.loading != nil {
+			// 其他消息正在获取同一群组的管理员列表，等待结果
+			c.mu.Unlock()
+			select {
+			case <-e.loading:
+				continue
+			case <-ctx.Done():
+				return false, ctx.Err()
+			}
+		}
+		if e != nil && time.Now().Before(e.expires) {
+			c.mu.Unlock()
+			if e.err != nil {
+				return false, e.err
+			}
+			return e.admins[userID], nil
+		}
+		loading := make(chan struct{})
+		c.entries[chatID] = &adminEntry{loading: loading}
+		c.mu.Unlock()
+
+		list, err := c.fetch(ctx, chatID)
+		c.mu.Lock()
+		switch {
+		case err == nil:
+			c.entries[chatID] = &adminEntry{admins: list, expires: time.Now().Add(adminCacheTTL)}
+		case ctx.Err() != nil:
+			// 当前消息的处理被取消，不是获取失败，下一条消息重新获取
+			delete(c.entries, chatID)
+		default:
+			c.entries[chatID] = &adminEntry{err: err, expires: time.Now().Add(adminErrorTTL)}
+		}
+		c.mu.Unlock()
+		close(loading)
+
+		if err != nil {
+			return false, err
+		}
+		return list[userID], nil
+	}
+}
+
+// fetchAdmins 通过 ChannelsGetParticipants 获取群组的管理员
+func fetchAdmins(ctx context.Context, chatID int64) (map[int64]bool, error) {
+	api := tgAPI.Load()
+	if api == nil {
+		return nil, fmt.Errorf("客户端未就绪")
+	}
+
+	channel, err := resolveChannel(ctx, api, selfID.Load(), chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := api.ChannelsGetParticipants(ctx, &tg.ChannelsGetParticipantsRequest{
+		Channel: channel.AsInput(),
+		Filter:  &tg.ChannelParticipantsAdmins{},
+		Limit:   200,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取管理员列表失败: %w", err)
+	}
+
+	list := make(map[int64]bool)
+	if participants, ok := result.(*tg.ChannelsChannelParticipants); ok {
+		for _, p := range participants.Participants {
+			switch p := p.(type) {
+			case *tg.ChannelParticipantCreator:
+				list[p.UserID] = true
+			case *tg.ChannelParticipantAdmin:
+				list[p.UserID] = true
+			}
+		}
+	}
+	logChannels.Info("已获取群组管理员", "chat", channel.ID, "title", channel.Title, "admins", len(list))
+	return list, nil
+}
+
+// setSender 从消息和实体中填充发送者信息
+// 用户以自己的频道身份发言时 FromID 是该频道，只有 FromID 是群组自身（匿名管理员）时才没有发送者
+func (s *messageSource) setSender(msg *tg.Message, users map[int64]*tg.User) {
+	switch from := msg.FromID.(type) {
+	case *tg.PeerUser:
+		s.SenderID = from.UserID
+		if user, ok := users[from.UserID]; ok {
+			s.SenderName = strings.TrimSpace(user.FirstName + " " + user.LastName)
+			s.SenderUsername = user.Username
+			s.SenderBot = user.Bot
+		}
+	case *tg.PeerChannel:
+		if from.ChannelID != s.PeerID {
+			s.SenderID = from.ChannelID
+			s.SenderChannel = true
+		}
+	}
+}
+
+// SenderLabel 返回发送者描述，如 Zhang San (@zhangsan)，频道自身发布的消息返回空字符串
+func (s messageSource) SenderLabel() string {
+	if s.SenderID == 0 {
+		return ""
+	}
+	label := s.SenderName
+	if label == "" {
+		label = strconv.FormatInt(s.SenderID, 10)
+	}
+	if s.SenderChannel {
+		label = "频道 " + label
+	}
+	if s.SenderUsername != "" {
+		label += " (@" + s.SenderUsername + ")"
+	}
+	if s.SenderBot {
+		label += " [bot]"
+	}
+	return label
+}
+
+// matchSender 检查发送者是否匹配列表中的用户 ID、频道 ID 或用户名
+func matchSender(list []string, s messageSource) bool {
+	for _, item := range list {
+		item = strings.TrimSpace(item)
+		if id, err := strconv.ParseInt(item, 10, 64); err == nil {
+			if id == s.SenderID {
+				return true
+			}
+			continue
+		}
+		if s.SenderUsername != "" && strings.EqualFold(strings.TrimPrefix(item, "@"), s.SenderUsername) {
+			return true
+		}
+	}
+	return false
+}
+
+// senderDecision 按频道配置检查消息发送者，返回是否允许和原因
+// 频道自身或匿名管理员发布的消息没有发送者，始终允许
+// 以频道身份发送的消息按频道 ID 匹配 allow_senders / deny_senders，admins_only 时拒绝，
+// deny_bots 和 max_sender_id 只针对用户账号
+func (l *listener) senderDecision(ctx context.Context, s messageSource) (bool, string) {
+	opts, ok := l.settings.ChannelOptions[s.PeerID]
+	if !ok {
+		opts = l.settings.ChannelOptions[s.ChannelID]
+	}
+	if s.SenderID == 0 {
+		return true, "没有发送者（频道自身或匿名管理员）"
+	}
+
+	sender := s.SenderLabel()
+	if opts.DenyBots && s.SenderBot {
+		return false, sender + " 是机器人"
+	}
+	if opts.MaxSenderID > 0 && !s.SenderChannel && s.SenderID > opts.MaxSenderID {
+		return false, fmt.Sprintf("%s 的用户 ID 大于 max_sender_id %d（新注册的账号）", sender, opts.MaxSenderID)
+	}
+	if matchSender(opts.DenySenders, s) {
+		return false, sender + " 在 deny_senders 中"
+	}
+	if len(opts.AllowSenders) > 0 && !matchSender(opts.AllowSenders, s) {
+		return false, sender + " 不在 allow_senders 中"
+	}
+	if opts.AdminsOnly {
+		if s.SenderChannel {
+			return false, sender + " 以频道身份发送，不是管理员"
+		}
+		isAdmin, err := admins.isAdmin(ctx, s.PeerID, s.SenderID)
+		if err != nil {
+			logFilter.Warn("检查管理员失败", "chat", s.PeerID, "user", s.SenderID, "error", err)
+			return false, "检查管理员失败: " + err.Error()
+		}
+		if !isAdmin {
+			return false, sender + " 不是管理员"
+		}
+		return true, sender + " 是管理员"
+	}
+	return true, sender
+}
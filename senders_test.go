@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/tg"
+
+	"simple-listener/internal/config"
+)
+
+func TestAdminCache(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	c := &adminCache{
+		entries: make(map[int64]*adminEntry),
+		fetch: func(ctx context.Context, chatID int64) (map[int64]bool, error) {
+			calls.Add(1)
+			<-release
+			if chatID == 2 {
+				return nil, errors.New("CHAT_ADMIN_REQUIRED")
+			}
+			return map[int64]bool{10: true}, nil
+		},
+	}
+	ctx := context.Background()
+
+	// 同一群组同时只有一个请求，其余等待结果
+	var wg sync.WaitGroup
+	results := make([]bool, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = c.isAdmin(ctx, 1, 10)
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	for i, ok := range results {
+		if !ok {
+			t.Errorf("results[%d] = false", i)
+		}
+	}
+	if ok, err := c.isAdmin(ctx, 1, 11); ok || err != nil {
+		t.Errorf("isAdmin(非管理员) = %v, %v", ok, err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("获取了 %d 次管理员列表, want 1", n)
+	}
+
+	// 获取失败时缓存错误，不会每条消息都重新请求
+	for i := 0; i < 3; i++ {
+		if _, err := c.isAdmin(ctx, 2, 10); err == nil {
+			t.Error("获取失败时应返回错误")
+		}
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("获取了 %d 次管理员列表, want 2", n)
+	}
+
+	// 错误过期后重新获取
+	c.entries[2].expires = time.Now().Add(-time.Second)
+	c.isAdmin(ctx, 2, 10)
+	if n := calls.Load(); n != 3 {
+		t.Errorf("获取了 %d 次管理员列表, want 3", n)
+	}
+}
+
+func TestSenderDecision(t *testing.T) {
+	l := &listener{settings: settings{ChannelOptions: map[int64]config.ChannelOptions{
+		1: {DenyBots: true, DenySenders: []string{"@spammer", "20"}, MaxSenderID: 7000000000},
+		2: {AllowSenders: []string{"@alice"}},
+		4: {AdminsOnly: true},
+		5: {DenySenders: []string{"555"}},
+	}}}
+
+	tests := []struct {
+		name    string
+		src     messageSource
+		allowed bool
+		reason  string
+	}{
+		{"没有发送者", messageSource{PeerID: 1}, true, "没有发送者"},
+		{"机器人", messageSource{PeerID: 1, SenderID: 10, SenderBot: true}, false, "是机器人"},
+		{"按用户名拒绝", messageSource{PeerID: 1, SenderID: 10, SenderUsername: "Spammer"}, false, "在 deny_senders 中"},
+		{"按 ID 拒绝", messageSource{PeerID: 1, SenderID: 20}, false, "在 deny_senders 中"},
+		{"新注册的账号", messageSource{PeerID: 1, SenderID: 7000000001}, false, "大于 max_sender_id"},
+		{"通过", messageSource{PeerID: 1, SenderID: 10, SenderName: "Bob"}, true, "Bob"},
+		{"在 allow_senders 中", messageSource{PeerID: 2, SenderID: 10, SenderUsername: "alice"}, true, "alice"},
+		{"不在 allow_senders 中", messageSource{PeerID: 2, SenderID: 10}, false, "不在 allow_senders 中"},
+		{"没有频道配置", messageSource{PeerID: 3, SenderID: 7000000001}, true, ""},
+		{"频道身份不在 allow_senders 中", messageSource{PeerID: 2, SenderID: 555, SenderChannel: true}, false, "不在 allow_senders 中"},
+		{"频道身份按 ID 拒绝", messageSource{PeerID: 5, SenderID: 555, SenderChannel: true}, false, "在 deny_senders 中"},
+		{"频道身份不是管理员", messageSource{PeerID: 4, SenderID: 555, SenderChannel: true}, false, "以频道身份发送"},
+		{"频道身份不受 max_sender_id 限制", messageSource{PeerID: 1, SenderID: 7000000001, SenderChannel: true}, true, "频道 7000000001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, reason := l.senderDecision(context.Background(), tt.src)
+			if allowed != tt.allowed || !strings.Contains(reason, tt.reason) {
+				t.Errorf("senderDecision() = %v, %q, want %v, %q", allowed, reason, tt.allowed, tt.reason)
+			}
+		})
+	}
+}
+
+func TestSetSender(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    tg.PeerClass
+		id      int64
+		channel bool
+	}{
+		{"频道自身发布", nil, 0, false},
+		{"匿名管理员", &tg.PeerChannel{ChannelID: 100}, 0, false},
+		{"用户", &tg.PeerUser{UserID: 10}, 10, false},
+		{"以自己的频道身份发送", &tg.PeerChannel{ChannelID: 555}, 555, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &tg.Message{PeerID: &tg.PeerChannel{ChannelID: 100}, FromID: tt.from}
+			src, _ := resolveSource(msg)
+			src.setSender(msg, nil)
+			if src.SenderID != tt.id || src.SenderChannel != tt.channel {
+				t.Errorf("setSender() = %d, %v, want %d, %v", src.SenderID, src.SenderChannel, tt.id, tt.channel)
+			}
+		})
+	}
+}
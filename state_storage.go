@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/telegram/updates"
+)
+
+// stateSaveInterval pts / qts / seq 等频繁变化的状态合并写入文件的间隔
+const stateSaveInterval = 5 * time.Second
+
+// fileStateStorage 将 updates 状态和频道 access hash 保存到 JSON 文件
+// 重启后 gaps 从保存的状态执行 getDifference，补齐停机期间错过的消息
+// 每条更新都会修改 pts，由 Run 定时写入，退出前调用 Flush 写入最新状态
+type fileStateStorage struct {
+	mu    sync.Mutex
+	path  string
+	data  stateFileData
+	dirty bool // 有尚未写入文件的修改
+}
+
+var (
+	_ updates.StateStorage        = (*fileStateStorage)(nil)
+	_ updates.ChannelAccessHasher = (*fileStateStorage)(nil)
+)
+
+// stateFileData 状态文件内容
+type stateFileData struct {
+	Users map[int64]*userStateData `json:"users"`
+}
+
+// userStateData 单个账号的 updates 状态
+type userStateData struct {
+	State        *updates.State  `json:"state,omitempty"`
+	ChannelPts   map[int64]int   `json:"channel_pts"`
+	AccessHashes map[int64]int64 `json:"access_hashes"`
+}
+
+// newFileStateStorage 打开状态文件，文件不存在时创建空状态
+func newFileStateStorage(path string) (*fileStateStorage, error) {
+	s := &fileStateStorage{
+		path: path,
+		data: stateFileData{Users: make(map[int64]*userStateData)},
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("读取状态文件失败: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.data); err != nil {
+		return nil, fmt.Errorf("解析状态文件失败: %w", err)
+	}
+	if s.data.Users == nil {
+		s.data.Users = make(map[int64]*userStateData)
+	}
+	return s, nil
+}
+
+// user 返回账号的状态，不存在时创建（调用方需持有锁）
+func (s *fileStateStorage) user(userID int64) *userStateData {
+	u, ok := s.data.Users[userID]
+	if !ok {
+		u = &userStateData{}
+		s.data.Users[userID] = u
+	}
+	if u.ChannelPts == nil {
+		u.ChannelPts = make(map[int64]int)
+	}
+	if u.AccessHashes == nil {
+		u.AccessHashes = make(map[int64]int64)
+	}
+	return u
+}
+
+// save 将状态写入文件，先写临时文件再改名，避免写入中断导致文件损坏（调用方需持有锁）
+func (s *fileStateStorage) save() error {
+	data, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("编码状态失败: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("写入状态文件失败: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("写入状态文件失败: %w", err)
+	}
+	return nil
+}
+
+// flush 有未写入的修改时写入文件（调用方需持有锁）
+func (s *fileStateStorage) flush() error {
+	if !s.dirty {
+		return nil
+	}
+	if err := s.save(); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// Flush 立即写入尚未保存的状态
+func (s *fileStateStorage) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.flush()
+}
+
+// Run 定时写入尚未保存的状态，直到 ctx 结束
+func (s *fileStateStorage) Run(ctx context.Context) {
+	ticker := time.NewTicker(stateSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Flush(); err != nil {
+				logUpdates.Error("保存 updates 状态失败", "error", err)
+			}
+		}
+	}
+}
+
+// update 修改已存在的账号状态，由 Run 定时写入文件，状态不存在时返回错误
+func (s *fileStateStorage) update(userID int64, fn func(state *updates.State)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.data.Users[userID]
+	if !ok || u.State == nil {
+		return fmt.Errorf("用户 %d 的状态不存在", userID)
+	}
+	fn(u.State)
+	s.dirty = true
+	return nil
+}
+
+func (s *fileStateStorage) GetState(_ context.Context, userID int64) (updates.State, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.data.Users[userID]
+	if !ok || u.State == nil {
+		return updates.State{}, false, nil
+	}
+	return *u.State, true, nil
+}
+
+func (s *fileStateStorage) SetState(_ context.Context, userID int64, state updates.State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.user(userID)
+	u.State = &state
+	// 重新获取远端状态后，旧的频道 pts 已不再有效，立即写入
+	u.ChannelPts = make(map[int64]int)
+	s.dirty = true
+	return s.flush()
+}
+
+func (s *fileStateStorage) SetPts(_ context.Context, userID int64, pts int) error {
+	return s.update(userID, func(state *updates.State) { state.Pts = pts })
+}
+
+func (s *fileStateStorage) SetQts(_ context.Context, userID int64, qts int) error {
+	return s.update(userID, func(state *updates.State) { state.Qts = qts })
+}
+
+func (s *fileStateStorage) SetDate(_ context.Context, userID int64, date int) error {
+	return s.update(userID, func(state *updates.State) { state.Date = date })
+}
+
+func (s *fileStateStorage) SetSeq(_ context.Context, userID int64, seq int) error {
+	return s.update(userID, func(state *updates.State) { state.Seq = seq })
+}
+
+func (s *fileStateStorage) SetDateSeq(_ context.Context, userID int64, date, seq int) error {
+	return s.update(userID, func(state *updates.State) {
+		state.Date = date
+		state.Seq = seq
+	})
+}
+
+func (s *fileStateStorage) GetChannelPts(_ context.Context, userID, channelID int64) (int, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.data.Users[userID]
+	if !ok {
+		return 0, false, nil
+	}
+	pts, ok := u.ChannelPts[channelID]
+	return pts, ok, nil
+}
+
+func (s *fileStateStorage) SetChannelPts(_ context.Context, userID, channelID int64, pts int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.user(userID).ChannelPts[channelID] = pts
+	s.dirty = true
+	return nil
+}
+
+func (s *fileStateStorage) ForEachChannels(ctx context.Context, userID int64, f func(ctx context.Context, channelID int64, pts int) error) error {
+	// 复制一份再回调，避免回调中再次访问存储导致死锁
+	s.mu.Lock()
+	channels := make(map[int64]int)
+	if u, ok := s.data.Users[userID]; ok {
+		for id, pts := range u.ChannelPts {
+			channels[id] = pts
+		}
+	}
+	s.mu.Unlock()
+
+	for id, pts := range channels {
+		if err := f(ctx, id, pts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fileStateStorage) SetChannelAccessHash(_ context.Context, userID, channelID, accessHash int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.user(userID)
+	if u.AccessHashes[channelID] == accessHash {
+		return nil
+	}
+	// 新的 access hash 很少出现，丢失后无法访问频道，立即写入
+	u.AccessHashes[channelID] = accessHash
+	s.dirty = true
+	return s.flush()
+}
+
+func (s *fileStateStorage) GetChannelAccessHash(_ context.Context, userID, channelID int64) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.data.Users[userID]
+	if !ok {
+		return 0, false, nil
+	}
+	hash, ok := u.AccessHashes[channelID]
+	return hash, ok, nil
+}
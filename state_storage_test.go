@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/gotd/td/telegram/updates"
+)
+
+func TestFileStateStorageFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := newFileStateStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := s.SetState(ctx, 1, updates.State{Pts: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	// pts 的修改在 Flush 之前不写入文件
+	if err := s.SetPts(ctx, 1, 11); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetChannelPts(ctx, 1, 100, 5); err != nil {
+		t.Fatal(err)
+	}
+	load := func() *fileStateStorage {
+		t.Helper()
+		loaded, err := newFileStateStorage(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return loaded
+	}
+	if state, _, _ := load().GetState(ctx, 1); state.Pts != 10 {
+		t.Errorf("Flush 前保存的 pts = %d, want 10", state.Pts)
+	}
+
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	loaded := load()
+	if state, _, _ := loaded.GetState(ctx, 1); state.Pts != 11 {
+		t.Errorf("Flush 后保存的 pts = %d, want 11", state.Pts)
+	}
+	if pts, ok, _ := loaded.GetChannelPts(ctx, 1, 100); !ok || pts != 5 {
+		t.Errorf("频道 pts = %d, %v, want 5", pts, ok)
+	}
+}
@@ -0,0 +1,13 @@
+package main
+
+import "simple-listener/internal/store"
+
+// saveRecord 保存消息记录，失败时只输出警告
+func (l *listener) saveRecord(r *store.MessageRecord) {
+	if l.links == nil {
+		return
+	}
+	if err := l.links.Save(r); err != nil {
+		logStore.Error("保存链接记录失败", "error", err)
+	}
+}
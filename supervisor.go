@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// 运行过程中因长时间无进展而主动中断连接
+var errStalled = errors.New("连接长时间无进展")
+
+// reconnectBackoff 指数退避，连接稳定运行一段时间后重置
+type reconnectBackoff struct {
+	initial time.Duration
+	max     time.Duration
+	current time.Duration
+}
+
+func newReconnectBackoff(initial, max time.Duration) *reconnectBackoff {
+	return &reconnectBackoff{initial: initial, max: max}
+}
+
+// Next 返回下一次重连前的等待时间
+func (b *reconnectBackoff) Next() time.Duration {
+	if b.current == 0 {
+		b.current = b.initial
+	} else {
+		b.current *= 2
+	}
+	if b.current > b.max {
+		b.current = b.max
+	}
+	return b.current
+}
+
+// Reset 连接恢复正常后重置等待时间
+func (b *reconnectBackoff) Reset() {
+	b.current = 0
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+
+	"simple-listener/internal/filter"
+)
+
+// 保留的最近过滤记录条数
+const traceCapacity = 500
+
+// messageTrace 一条消息的过滤过程
+type messageTrace struct {
+	Time       time.Time     `json:"time"`
+	Source     string        `json:"source"`
+	ChannelID  int64         `json:"channel_id"`
+	MessageIDs []int         `json:"message_ids"`
+	Text       string        `json:"text,omitempty"` // 前 200 个字符
+	Outcome    string        `json:"outcome"`
+	Rule       string        `json:"rule,omitempty"`
+	Steps      []filter.Step `json:"steps"`
+}
+
+// traceLog 最近的过滤记录，供管理 API 查询
+type traceLog struct {
+	mu      sync.Mutex
+	entries []*messageTrace
+	next    int
+}
+
+var traces = &traceLog{}
+
+// add 添加记录，超过容量时覆盖最旧的记录
+func (l *traceLog) add(t *messageTrace) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.entries) < traceCapacity {
+		l.entries = append(l.entries, t)
+		return
+	}
+	l.entries[l.next] = t
+	l.next = (l.next + 1) % traceCapacity
+}
+
+// Recent 返回最近的记录，最新的在前；channelID 和 outcome 不为零值时只返回匹配的记录
+func (l *traceLog) Recent(n int, channelID int64, outcome string) []*messageTrace {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := []*messageTrace{}
+	for i := 0; i < len(l.entries) && len(result) < n; i++ {
+		// 从最新的一条往前
+		t := l.entries[(l.next-1-i+2*len(l.entries))%len(l.entries)]
+		if channelID != 0 && t.ChannelID != channelID {
+			continue
+		}
+		if outcome != "" && t.Outcome != outcome {
+			continue
+		}
+		result = append(result, t)
+	}
+	return result
+}
+
+// recordTrace 保存过滤过程并输出 debug 日志
+func recordTrace(src messageSource, messages []*tg.Message, text string, verdict filter.Verdict) {
+	t := &messageTrace{
+		Time:      time.Now(),
+		Source:    src.Label(),
+		ChannelID: src.ChannelID,
+		Outcome:   verdict.Outcome,
+		Rule:      verdict.Rule,
+		Steps:     verdict.Trace,
+	}
+	for _, m := range messages {
+		t.MessageIDs = append(t.MessageIDs, m.ID)
+	}
+	if text == "" {
+		// 在内容过滤之前被跳过，使用消息原文
+		text = messages[0].Message
+	}
+	if r := []rune(text); len(r) > 200 {
+		t.Text = string(r[:200])
+	} else {
+		t.Text = text
+	}
+	traces.add(t)
+
+	if logFilter.Enabled(context.Background(), slog.LevelDebug) {
+		steps := make([]string, len(verdict.Trace))
+		for i, s := range verdict.Trace {
+			steps[i] = s.String()
+		}
+		logFilter.Debug("过滤结果",
+			"source", t.Source,
+			"messages", t.MessageIDs,
+			"outcome", verdict.Outcome,
+			"rule", verdict.Rule,
+			"trace", strings.Join(steps, " | "))
+	}
+}